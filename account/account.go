@@ -0,0 +1,284 @@
+// Package account provides user registration and login using client certificates.
+//
+// When a client presents a certificate that isn't linked to an account, the
+// Handler prompts for a username and binds it to the certificate fingerprint.
+// Further certificates can be linked to the account with a one-time token.
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/log"
+)
+
+// DefaultNamePattern is the pattern that usernames must match, unless Accounts.NamePattern is set.
+var DefaultNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// DefaultTokenTTL is the time that a link token is valid for.
+const DefaultTokenTTL = time.Minute * 15
+
+// DefaultPromptTTL is the time that a client has to answer the registration prompt.
+const DefaultPromptTTL = time.Minute * 10
+
+// ErrInvalidToken is returned when a link token doesn't exist or has expired.
+var ErrInvalidToken = errors.New("account: invalid or expired token")
+
+// ErrInvalidName is returned when a username doesn't match the NamePattern.
+var ErrInvalidName = errors.New("account: invalid name")
+
+// Accounts registers users and links certificates to them.
+type Accounts struct {
+	Store Store
+	// NamePattern that usernames must match.
+	NamePattern *regexp.Regexp
+	// TokenTTL is the time that link tokens are valid for.
+	TokenTTL time.Duration
+	// PromptTTL is the time that a client has to answer the registration prompt.
+	PromptTTL time.Duration
+
+	m      sync.Mutex
+	tokens map[string]token
+	// prompts are the paths that each unregistered certificate was prompted for a
+	// username on. Input is only accepted as a username on the same path.
+	prompts map[string]prompt
+	now     func() time.Time
+}
+
+type prompt struct {
+	path    string
+	expires time.Time
+}
+
+type token struct {
+	name    string
+	expires time.Time
+}
+
+// New creates Accounts that keep users in the store.
+func New(store Store) *Accounts {
+	return &Accounts{
+		Store:       store,
+		NamePattern: DefaultNamePattern,
+		TokenTTL:    DefaultTokenTTL,
+		PromptTTL:   DefaultPromptTTL,
+		tokens:      make(map[string]token),
+		prompts:     make(map[string]prompt),
+		now:         time.Now,
+	}
+}
+
+// Register a new user, bound to the certificate fingerprint.
+func (a *Accounts) Register(name, fingerprint string) (u User, err error) {
+	if !a.NamePattern.MatchString(name) {
+		err = fmt.Errorf("%w %q", ErrInvalidName, name)
+		return
+	}
+	return a.Store.Create(name, fingerprint, a.now())
+}
+
+// CreateLinkToken creates a one-time token that links another certificate to the user.
+// Tokens are held in memory, and expire after TokenTTL.
+func (a *Accounts) CreateLinkToken(name string) (t string, err error) {
+	if _, err = a.Store.Get(name); err != nil {
+		return
+	}
+	b := make([]byte, 20)
+	if _, err = rand.Read(b); err != nil {
+		err = fmt.Errorf("account: failed to create token: %w", err)
+		return
+	}
+	t = tokenPrefix + base32.StdEncoding.EncodeToString(b)
+	a.m.Lock()
+	defer a.m.Unlock()
+	now := a.now()
+	for k, v := range a.tokens {
+		if now.After(v.expires) {
+			delete(a.tokens, k)
+		}
+	}
+	a.tokens[t] = token{name: name, expires: now.Add(a.TokenTTL)}
+	return
+}
+
+// Link the certificate fingerprint to the user that created the token. The token
+// can only be used once.
+func (a *Accounts) Link(t, fingerprint string) (u User, err error) {
+	a.m.Lock()
+	tok, ok := a.tokens[t]
+	if ok {
+		delete(a.tokens, t)
+	}
+	a.m.Unlock()
+	if !ok || a.now().After(tok.expires) {
+		err = ErrInvalidToken
+		return
+	}
+	return a.Store.Link(tok.name, fingerprint)
+}
+
+// tokenPrefix distinguishes link tokens from usernames, so that a used or expired
+// token is never registered as a username.
+const tokenPrefix = "link:"
+
+type contextKey struct{}
+
+// WithUser returns a copy of the context that contains the user.
+func WithUser(ctx context.Context, u User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// FromContext returns the user attached to the context by Handler.
+func FromContext(ctx context.Context) (u User, ok bool) {
+	if ctx == nil {
+		return
+	}
+	u, ok = ctx.Value(contextKey{}).(User)
+	return
+}
+
+// Get the user that made the request.
+func Get(r *gemini.Request) (u User, ok bool) {
+	return FromContext(r.Context)
+}
+
+// Prompts shown to users that aren't registered.
+const (
+	PromptRegister  = "Choose a username, or enter a link token to add this certificate to an existing account"
+	PromptNameTaken = "That username is taken, choose another"
+	PromptInvalid   = "Usernames must be 1-32 letters, numbers, - or _, choose another"
+)
+
+// Handler requires the client to present a certificate linked to an account, and
+// attaches the user to the request context before calling h.
+//
+// If the certificate isn't linked to an account, the client is prompted (10) for a
+// username, or a link token created by CreateLinkToken. Only the reply to the prompt is
+// used as the username, input sent on other requests is ignored. Once the certificate
+// is registered, the client is redirected back to the requested URL.
+func (a *Accounts) Handler(h gemini.Handler) gemini.Handler {
+	return gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		fingerprint := r.Certificate.ID
+		if fingerprint == "" {
+			w.SetHeader(gemini.CodeClientCertificateRequired, "client certificate required")
+			return
+		}
+		if r.Certificate.Error != "" {
+			w.SetHeader(gemini.CodeClientCertificateNotValid, r.Certificate.Error)
+			return
+		}
+		u, err := a.Store.GetByFingerprint(fingerprint)
+		if err == nil {
+			ctx := r.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ur := *r
+			ur.Context = WithUser(ctx, u)
+			h.ServeGemini(w, &ur)
+			return
+		}
+		if !errors.Is(err, ErrNotFound) {
+			log.Error("account: failed to get user", err, log.String("url", r.URL.String()))
+			w.SetHeader(gemini.CodeTemporaryFailure, "temporary failure")
+			return
+		}
+		a.register(w, r)
+	})
+}
+
+func (a *Accounts) register(w gemini.ResponseWriter, r *gemini.Request) {
+	input, err := r.Input()
+	if errors.Is(err, gemini.ErrNoInput) || !a.prompted(r.Certificate.ID, r.URL.Path) {
+		a.prompt(w, r.Certificate.ID, r.URL.Path, PromptRegister)
+		return
+	}
+	if err != nil {
+		gemini.BadRequest(w, r)
+		return
+	}
+	input = strings.TrimSpace(input)
+	var u User
+	if strings.HasPrefix(input, tokenPrefix) {
+		u, err = a.Link(input, r.Certificate.ID)
+	} else {
+		u, err = a.Register(input, r.Certificate.ID)
+	}
+	switch {
+	case errors.Is(err, ErrAlreadyLinked):
+		// The certificate was registered by another request, so it can use the requested URL.
+		log.Warn("account: certificate already registered", log.String("certificateID", r.Certificate.ID))
+	case errors.Is(err, ErrNameTaken):
+		a.prompt(w, r.Certificate.ID, r.URL.Path, PromptNameTaken)
+		return
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrNotFound):
+		a.prompt(w, r.Certificate.ID, r.URL.Path, PromptRegister)
+		return
+	case errors.Is(err, ErrInvalidName):
+		a.prompt(w, r.Certificate.ID, r.URL.Path, PromptInvalid)
+		return
+	case err != nil:
+		log.Error("account: failed to register user", err, log.String("url", r.URL.String()))
+		w.SetHeader(gemini.CodeTemporaryFailure, "temporary failure")
+		return
+	default:
+		log.Info("account: certificate registered",
+			log.String("name", u.Name),
+			log.String("certificateID", r.Certificate.ID))
+	}
+	a.m.Lock()
+	delete(a.prompts, r.Certificate.ID)
+	a.m.Unlock()
+	redirect := *r.URL
+	redirect.RawQuery = ""
+	w.SetHeader(gemini.CodeRedirect, redirect.String())
+}
+
+// prompt the client for a username, and record the path that the prompt was sent on.
+func (a *Accounts) prompt(w gemini.ResponseWriter, fingerprint, path, text string) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	now := a.now()
+	for k, v := range a.prompts {
+		if now.After(v.expires) {
+			delete(a.prompts, k)
+		}
+	}
+	a.prompts[fingerprint] = prompt{path: path, expires: now.Add(a.PromptTTL)}
+	w.SetHeader(gemini.CodeInput, text)
+}
+
+// prompted returns true if the client was prompted for a username on the path.
+func (a *Accounts) prompted(fingerprint, path string) bool {
+	a.m.Lock()
+	defer a.m.Unlock()
+	p, ok := a.prompts[fingerprint]
+	return ok && p.path == path && !a.now().After(p.expires)
+}
+
+// LinkTokenHandler creates a link token for the current user and displays it, along
+// with instructions for adding another certificate. It must be wrapped by Handler.
+func (a *Accounts) LinkTokenHandler() gemini.Handler {
+	return gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		u, ok := Get(r)
+		if !ok {
+			w.SetHeader(gemini.CodeClientCertificateRequired, "client certificate required")
+			return
+		}
+		t, err := a.CreateLinkToken(u.Name)
+		if err != nil {
+			log.Error("account: failed to create link token", err, log.String("url", r.URL.String()))
+			w.SetHeader(gemini.CodeTemporaryFailure, "temporary failure")
+			return
+		}
+		fmt.Fprintf(w, "# Link a certificate\n\nTo use another certificate with the account %q, visit this site with the new certificate and enter the token below when asked for a username. The token can be used once, and expires in %v.\n\n```\n%s\n```\n", u.Name, a.TokenTTL, t)
+	})
+}
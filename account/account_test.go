@@ -0,0 +1,186 @@
+package account
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-h/gemini"
+)
+
+func TestHandler(t *testing.T) {
+	a := New(NewMemoryStore())
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+	h := a.Handler(gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		u, _ := Get(r)
+		if r.URL.Path == "/link" {
+			a.LinkTokenHandler().ServeGemini(w, r)
+			return
+		}
+		w.Write([]byte("Hello " + u.Name))
+	}))
+
+	request := func(id, path, query string) (resp *gemini.Response, body string) {
+		r := &gemini.Request{
+			Context:     context.Background(),
+			URL:         &url.URL{Scheme: "gemini", Host: "example.com", Path: path, RawQuery: query},
+			Certificate: gemini.Certificate{ID: id},
+		}
+		resp, err := gemini.Record(r, h)
+		if err != nil {
+			t.Fatalf("failed to record request: %v", err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		return resp, string(b)
+	}
+	expect := func(name string, resp *gemini.Response, code gemini.Code, meta string) {
+		if resp.Header.Code != code || resp.Header.Meta != meta {
+			t.Errorf("%s: expected %v %q, got %v %q", name, code, meta, resp.Header.Code, resp.Header.Meta)
+		}
+	}
+
+	resp, _ := request("", "/", "")
+	expect("no certificate", resp, gemini.CodeClientCertificateRequired, "client certificate required")
+
+	resp, _ = request("cert1", "/search", "term")
+	expect("input before the prompt is ignored", resp, gemini.CodeInput, PromptRegister)
+	if _, err := a.Store.Get("term"); err != ErrNotFound {
+		t.Errorf("expected input sent before the prompt not to register a user, got %v", err)
+	}
+
+	resp, _ = request("cert1", "/", "")
+	expect("unknown certificate", resp, gemini.CodeInput, PromptRegister)
+
+	resp, _ = request("cert1", "/", "not%20valid")
+	expect("invalid username", resp, gemini.CodeInput, PromptInvalid)
+
+	resp, _ = request("cert1", "/page", "alice")
+	expect("input on another URL is ignored", resp, gemini.CodeInput, PromptRegister)
+
+	resp, _ = request("cert1", "/page", "alice")
+	expect("registration", resp, gemini.CodeRedirect, "gemini://example.com/page")
+
+	resp, body := request("cert1", "/page", "")
+	expect("registered certificate", resp, gemini.CodeSuccess, gemini.DefaultMIMEType)
+	if body != "Hello alice" {
+		t.Errorf("expected the user to be on the context, got %q", body)
+	}
+
+	request("cert2", "/", "")
+	resp, _ = request("cert2", "/", "alice")
+	expect("name taken", resp, gemini.CodeInput, PromptNameTaken)
+
+	_, body = request("cert1", "/link", "")
+	token := regexp.MustCompile("```\n(.+)\n```").FindStringSubmatch(body)
+	if len(token) != 2 {
+		t.Fatalf("expected a token in the link page, got %q", body)
+	}
+
+	resp, _ = request("cert2", "/", url.PathEscape(token[1]))
+	expect("link", resp, gemini.CodeRedirect, "gemini://example.com/")
+	_, body = request("cert2", "/", "")
+	if body != "Hello alice" {
+		t.Errorf("expected the linked certificate to log in as alice, got %q", body)
+	}
+
+	resp, _ = request("cert3", "/", url.PathEscape(token[1]))
+	if resp.Header.Code == gemini.CodeRedirect {
+		t.Errorf("expected tokens to be single use")
+	}
+
+	t2, err := a.CreateLinkToken("alice")
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	now = now.Add(DefaultTokenTTL + time.Second)
+	if _, err = a.Link(t2, "cert4"); err != ErrInvalidToken {
+		t.Errorf("expected expired token to be rejected, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_accounts")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.json")
+
+	s, err := LoadFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to load store: %v", err)
+	}
+	if _, err = s.Create("alice", "cert1", time.Now()); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err = s.Link("alice", "cert2"); err != nil {
+		t.Fatalf("failed to link certificate: %v", err)
+	}
+	if _, err = s.Create("bob", "cert2", time.Now()); err != ErrAlreadyLinked {
+		t.Errorf("expected ErrAlreadyLinked, got %v", err)
+	}
+
+	loaded, err := LoadFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to reload store: %v", err)
+	}
+	u, err := loaded.GetByFingerprint("cert2")
+	if err != nil {
+		t.Fatalf("failed to get user by fingerprint: %v", err)
+	}
+	if u.Name != "alice" || strings.Join(u.Fingerprints, ",") != "cert1,cert2" {
+		t.Errorf("unexpected user %+v", u)
+	}
+}
+
+func TestFileStoreRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_accounts")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.json")
+
+	s, err := LoadFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to load store: %v", err)
+	}
+	if _, err = s.Create("alice", "cert1", time.Now()); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	// Saving fails when the directory doesn't exist.
+	s.Path = filepath.Join(dir, "missing", "users.json")
+	if _, err = s.Create("bob", "cert2", time.Now()); err == nil {
+		t.Fatalf("expected an error saving the store")
+	}
+	if _, err = s.Get("bob"); err != ErrNotFound {
+		t.Errorf("expected the user not to be created, got %v", err)
+	}
+	if _, err = s.GetByFingerprint("cert2"); err != ErrNotFound {
+		t.Errorf("expected the certificate not to be linked, got %v", err)
+	}
+	if _, err = s.Link("alice", "cert3"); err == nil {
+		t.Fatalf("expected an error saving the store")
+	}
+	u, err := s.Get("alice")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if strings.Join(u.Fingerprints, ",") != "cert1" {
+		t.Errorf("expected the link to be rolled back, got %v", u.Fingerprints)
+	}
+	if _, err = s.GetByFingerprint("cert3"); err != ErrNotFound {
+		t.Errorf("expected the certificate not to be linked, got %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/a-h/gemini/internal/atomicfile"
+)
+
+// User is an account bound to one or more client certificates.
+type User struct {
+	// Name chosen by the user when they registered.
+	Name string `json:"name"`
+	// Fingerprints of the client certificates linked to the account.
+	Fingerprints []string `json:"fingerprints"`
+	// Created is the time that the user registered.
+	Created time.Time `json:"created"`
+}
+
+func (u User) copy() User {
+	u.Fingerprints = append([]string(nil), u.Fingerprints...)
+	return u
+}
+
+// Store of user accounts.
+type Store interface {
+	// Get a user by name. If the user doesn't exist, ErrNotFound is returned.
+	Get(name string) (User, error)
+	// GetByFingerprint gets the user linked to a certificate fingerprint. If no user is
+	// linked to the certificate, ErrNotFound is returned.
+	GetByFingerprint(fingerprint string) (User, error)
+	// Create a user, and link the certificate fingerprint to it. If the name is taken,
+	// ErrNameTaken is returned. If the fingerprint is linked to a user, ErrAlreadyLinked
+	// is returned.
+	Create(name, fingerprint string, created time.Time) (User, error)
+	// Link a certificate fingerprint to an existing user. If the fingerprint is linked
+	// to a user, ErrAlreadyLinked is returned.
+	Link(name, fingerprint string) (User, error)
+}
+
+// ErrNotFound is returned when a Store doesn't contain the requested user.
+var ErrNotFound = errors.New("account: not found")
+
+// ErrNameTaken is returned when a user with the requested name already exists.
+var ErrNameTaken = errors.New("account: name taken")
+
+// ErrAlreadyLinked is returned when a certificate is already linked to a user.
+var ErrAlreadyLinked = errors.New("account: certificate already linked")
+
+// NewMemoryStore creates a Store that holds users in memory.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:         make(map[string]User),
+		fingerprintTo: make(map[string]string),
+	}
+}
+
+// MemoryStore holds users in memory.
+type MemoryStore struct {
+	m             sync.RWMutex
+	users         map[string]User
+	fingerprintTo map[string]string
+}
+
+// Get a user by name.
+func (s *MemoryStore) Get(name string) (u User, err error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	u, ok := s.users[name]
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	return u.copy(), nil
+}
+
+// GetByFingerprint gets the user linked to a certificate fingerprint.
+func (s *MemoryStore) GetByFingerprint(fingerprint string) (u User, err error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	name, ok := s.fingerprintTo[fingerprint]
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	return s.users[name].copy(), nil
+}
+
+// Create a user.
+func (s *MemoryStore) Create(name, fingerprint string, created time.Time) (u User, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.users[name]; ok {
+		err = ErrNameTaken
+		return
+	}
+	if _, ok := s.fingerprintTo[fingerprint]; ok {
+		err = ErrAlreadyLinked
+		return
+	}
+	u = User{
+		Name:         name,
+		Fingerprints: []string{fingerprint},
+		Created:      created,
+	}
+	s.users[name] = u
+	s.fingerprintTo[fingerprint] = name
+	return u.copy(), nil
+}
+
+// Link a certificate fingerprint to an existing user.
+func (s *MemoryStore) Link(name, fingerprint string) (u User, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	u, ok := s.users[name]
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	if _, ok := s.fingerprintTo[fingerprint]; ok {
+		err = ErrAlreadyLinked
+		return
+	}
+	u.Fingerprints = append(u.copy().Fingerprints, fingerprint)
+	s.users[name] = u
+	s.fingerprintTo[fingerprint] = name
+	return u.copy(), nil
+}
+
+// delete the user, used to roll back a change that couldn't be saved.
+func (s *MemoryStore) delete(name string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, fp := range s.users[name].Fingerprints {
+		delete(s.fingerprintTo, fp)
+	}
+	delete(s.users, name)
+}
+
+// unlink the fingerprint from the user, used to roll back a change that couldn't be saved.
+func (s *MemoryStore) unlink(name, fingerprint string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	u, ok := s.users[name]
+	if !ok {
+		return
+	}
+	fingerprints := make([]string, 0, len(u.Fingerprints))
+	for _, fp := range u.Fingerprints {
+		if fp != fingerprint {
+			fingerprints = append(fingerprints, fp)
+		}
+	}
+	u.Fingerprints = fingerprints
+	s.users[name] = u
+	delete(s.fingerprintTo, fingerprint)
+}
+
+func (s *MemoryStore) list() (users []User) {
+	for _, u := range s.users {
+		users = append(users, u.copy())
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return
+}
+
+func (s *MemoryStore) set(users []User) {
+	for _, u := range users {
+		s.users[u.Name] = u
+		for _, fp := range u.Fingerprints {
+			s.fingerprintTo[fp] = u.Name
+		}
+	}
+}
+
+// LoadFileStore loads users from a JSON file. The file is created when the first
+// user registers.
+func LoadFileStore(path string) (s *FileStore, err error) {
+	s = &FileStore{Path: path, MemoryStore: NewMemoryStore()}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("account: failed to read users: %w", err)
+		return
+	}
+	var users []User
+	if err = json.Unmarshal(data, &users); err != nil {
+		err = fmt.Errorf("account: failed to decode users from %q: %w", path, err)
+		return
+	}
+	s.MemoryStore.set(users)
+	return
+}
+
+// FileStore holds users in memory, and writes them to a JSON file when they change.
+type FileStore struct {
+	Path string
+	*MemoryStore
+	w sync.Mutex
+}
+
+// Create a user and save the file.
+func (s *FileStore) Create(name, fingerprint string, created time.Time) (u User, err error) {
+	s.w.Lock()
+	defer s.w.Unlock()
+	if u, err = s.MemoryStore.Create(name, fingerprint, created); err != nil {
+		return
+	}
+	if err = s.save(); err != nil {
+		s.MemoryStore.delete(name)
+	}
+	return
+}
+
+// Link a certificate fingerprint to an existing user and save the file.
+func (s *FileStore) Link(name, fingerprint string) (u User, err error) {
+	s.w.Lock()
+	defer s.w.Unlock()
+	if u, err = s.MemoryStore.Link(name, fingerprint); err != nil {
+		return
+	}
+	if err = s.save(); err != nil {
+		s.MemoryStore.unlink(name, fingerprint)
+	}
+	return
+}
+
+func (s *FileStore) save() (err error) {
+	s.MemoryStore.m.RLock()
+	users := s.MemoryStore.list()
+	s.MemoryStore.m.RUnlock()
+	data, err := json.MarshalIndent(users, "", " ")
+	if err != nil {
+		return fmt.Errorf("account: failed to encode users: %w", err)
+	}
+	if err = atomicfile.Write(s.Path, data, 0600); err != nil {
+		return fmt.Errorf("account: failed to write users: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package gemini
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IsArchive returns true if the name has the extension of an archive that can be
+// served by OpenArchive: .zip, .tar, .tar.gz or .tgz.
+func IsArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Archive is a read-only FileSystem backed by a zip or tar(.gz) archive. The archive is
+// read into memory and indexed when it's opened, so it can be replaced on disk while the
+// server is running, and swapped in by calling Reload.
+type Archive struct {
+	// Path of the archive.
+	Path string
+	m    sync.RWMutex
+	fsys fs.FS
+}
+
+// OpenArchive opens a zip or tar archive. Tar archives can be gzip compressed.
+func OpenArchive(name string) (a *Archive, err error) {
+	a = &Archive{Path: name}
+	err = a.Reload()
+	return
+}
+
+// Reload reads the archive from disk again. Requests that are in progress continue to
+// use the previous contents. If the archive can't be read, the previous contents are kept.
+func (a *Archive) Reload() (err error) {
+	data, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		return fmt.Errorf("gemini: failed to read archive: %w", err)
+	}
+	var fsys fs.FS
+	if strings.HasSuffix(strings.ToLower(a.Path), ".zip") {
+		fsys, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	} else {
+		fsys, err = NewTarFS(bytes.NewReader(data))
+	}
+	if err != nil {
+		return fmt.Errorf("gemini: failed to read archive %q: %w", a.Path, err)
+	}
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.fsys = fsys
+	return nil
+}
+
+// Open a file in the archive.
+func (a *Archive) Open(name string) (File, error) {
+	a.m.RLock()
+	fsys := a.fsys
+	a.m.RUnlock()
+	return FS(fsys).Open(name)
+}
+
+// NewTarFS reads a tar archive, which may be gzip compressed, into memory, and returns
+// it as an fs.FS. Only regular files and directories are included, links are ignored.
+func NewTarFS(r io.Reader) (fsys fs.FS, err error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+	t := tarFS{".": &tarEntry{name: ".", mode: fs.ModeDir | 0555}}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(h.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			e := t.mkdirAll(name)
+			e.mode = fs.ModeDir | h.FileInfo().Mode().Perm()
+			e.modTime = h.ModTime
+		case tar.TypeReg:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			parent := t.mkdirAll(path.Dir(name))
+			e, ok := t[name]
+			if !ok {
+				e = &tarEntry{name: path.Base(name)}
+				t[name] = e
+				parent.children = append(parent.children, e)
+			}
+			e.mode = h.FileInfo().Mode().Perm()
+			e.modTime = h.ModTime
+			e.data = data
+		}
+	}
+	for _, e := range t {
+		sort.Slice(e.children, func(i, j int) bool { return e.children[i].name < e.children[j].name })
+	}
+	return t, nil
+}
+
+// tarFS is an in-memory index of a tar archive, keyed by path.
+type tarFS map[string]*tarEntry
+
+func (t tarFS) mkdirAll(name string) *tarEntry {
+	if e, ok := t[name]; ok {
+		return e
+	}
+	parent := t.mkdirAll(path.Dir(name))
+	e := &tarEntry{name: path.Base(name), mode: fs.ModeDir | 0555}
+	t[name] = e
+	parent.children = append(parent.children, e)
+	return e
+}
+
+func (t tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := t[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &tarFile{tarEntry: e, path: name, r: bytes.NewReader(e.data)}, nil
+}
+
+type tarEntry struct {
+	name     string
+	mode     fs.FileMode
+	modTime  time.Time
+	data     []byte
+	children []*tarEntry
+}
+
+func (e *tarEntry) Name() string               { return e.name }
+func (e *tarEntry) Size() int64                { return int64(len(e.data)) }
+func (e *tarEntry) Mode() fs.FileMode          { return e.mode }
+func (e *tarEntry) ModTime() time.Time         { return e.modTime }
+func (e *tarEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *tarEntry) Sys() interface{}           { return nil }
+func (e *tarEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *tarEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+type tarFile struct {
+	*tarEntry
+	path   string
+	r      *bytes.Reader
+	offset int
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.tarEntry, nil }
+func (f *tarFile) Close() error               { return nil }
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	if f.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: errNotFile}
+	}
+	return f.r.Read(p)
+}
+
+func (f *tarFile) ReadDir(count int) (entries []fs.DirEntry, err error) {
+	if !f.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: errNotDir}
+	}
+	remaining := f.children[f.offset:]
+	if count > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && count < len(remaining) {
+		remaining = remaining[:count]
+	}
+	for _, e := range remaining {
+		entries = append(entries, e)
+	}
+	f.offset += len(remaining)
+	return entries, nil
+}
@@ -0,0 +1,148 @@
+package gemini
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var archiveFiles = map[string]string{
+	"index.gmi":       "# Home\n",
+	"docs/a.gmi":      "# A\n",
+	"docs/sub/b.gmi":  "# B\n",
+	"other/c.txt":     "C",
+	"other/empty.gmi": "",
+}
+
+func writeTar(t *testing.T, w io.Writer, files map[string]string) {
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     "./" + name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if _, err = tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write tar content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+}
+
+func writeZip(t *testing.T, w io.Writer, files map[string]string) {
+	zw := zip.NewWriter(w)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		if _, err = f.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write zip content: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	var plain, compressed bytes.Buffer
+	writeTar(t, &plain, archiveFiles)
+	gz := gzip.NewWriter(&compressed)
+	writeTar(t, gz, archiveFiles)
+	gz.Close()
+
+	for name, data := range map[string][]byte{"tar": plain.Bytes(), "tar.gz": compressed.Bytes()} {
+		fsys, err := NewTarFS(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: failed to read archive: %v", name, err)
+		}
+		if err = fstest.TestFS(fsys, "index.gmi", "docs/a.gmi", "docs/sub/b.gmi", "other/c.txt", "other/empty.gmi"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_archive")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, ext := range []string{".zip", ".tar.gz"} {
+		ext := ext
+		t.Run(ext, func(t *testing.T) {
+			name := filepath.Join(dir, "site"+ext)
+			write := func(files map[string]string) {
+				var buf bytes.Buffer
+				if ext == ".zip" {
+					writeZip(t, &buf, files)
+				} else {
+					gz := gzip.NewWriter(&buf)
+					writeTar(t, gz, files)
+					gz.Close()
+				}
+				if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+					t.Fatalf("failed to write archive: %v", err)
+				}
+			}
+			write(archiveFiles)
+			if !IsArchive(name) {
+				t.Errorf("expected %q to be an archive", name)
+			}
+			a, err := OpenArchive(name)
+			if err != nil {
+				t.Fatalf("failed to open archive: %v", err)
+			}
+			get := func(p string) (code Code, body string) {
+				resp, err := Record(&Request{Context: context.Background(), URL: &url.URL{Path: p}}, FileSystemHandler(a))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				b, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatalf("unexpected error reading body: %v", err)
+				}
+				return resp.Header.Code, string(b)
+			}
+			if code, body := get("/"); code != CodeSuccess || body != "# Home\n" {
+				t.Errorf("expected the index to be served, got %v %q", code, body)
+			}
+			if code, body := get("/docs/"); code != CodeSuccess || body != "# Index of /docs/\n\n=> ../\n=> a.gmi\n=> sub/\n" {
+				t.Errorf("expected a directory listing, got %v %q", code, body)
+			}
+			if code, _ := get("/docs/sub/missing.gmi"); code != CodeNotFound {
+				t.Errorf("expected missing files to return not found, got %v", code)
+			}
+
+			write(map[string]string{"index.gmi": "# New home\n"})
+			if code, body := get("/"); body != "# Home\n" {
+				t.Errorf("expected the archive not to change until reloaded, got %v %q", code, body)
+			}
+			if err = a.Reload(); err != nil {
+				t.Fatalf("failed to reload archive: %v", err)
+			}
+			if code, body := get("/"); code != CodeSuccess || body != "# New home\n" {
+				t.Errorf("expected the reloaded index to be served, got %v %q", code, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Package auth provides authorisation policies for Gemini client certificates.
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/log"
+	"github.com/a-h/gemini/mux"
+)
+
+// ErrNotAuthorised is returned by a Policy when a valid certificate isn't allowed
+// access. It results in a 61 (certificate not authorised) response.
+var ErrNotAuthorised = errors.New("auth: not authorised")
+
+// ErrCertificateNotValid is returned by a Policy when a certificate fails verification,
+// e.g. because it wasn't signed by a trusted CA. It results in a 62 (certificate not valid) response.
+var ErrCertificateNotValid = errors.New("auth: certificate not valid")
+
+// Policy decides whether a client certificate is allowed access.
+type Policy interface {
+	// Authorise returns nil if the certificate is allowed access. Errors that wrap
+	// ErrCertificateNotValid result in a 62 response, all other errors result in a 61.
+	Authorise(c gemini.Certificate) error
+}
+
+// PolicyFunc is a function that implements Policy.
+type PolicyFunc func(c gemini.Certificate) error
+
+// Authorise implements Policy.
+func (f PolicyFunc) Authorise(c gemini.Certificate) error {
+	return f(c)
+}
+
+// AllowAll allows any certificate.
+var AllowAll = PolicyFunc(func(c gemini.Certificate) error { return nil })
+
+// Authoriser adapts the authoriser function used by gemini.RequireCertificateHandler to a Policy.
+func Authoriser(authoriser func(certID, certKey string) bool) Policy {
+	return PolicyFunc(func(c gemini.Certificate) error {
+		if authoriser(c.ID, c.Key) {
+			return nil
+		}
+		return ErrNotAuthorised
+	})
+}
+
+// All returns a Policy that allows access only if all of the policies allow access.
+func All(policies ...Policy) Policy {
+	return PolicyFunc(func(c gemini.Certificate) error {
+		for _, p := range policies {
+			if err := p.Authorise(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Any returns a Policy that allows access if any of the policies allow access. If none
+// do, the first error that indicates an invalid certificate is returned, otherwise
+// the last error is returned.
+func Any(policies ...Policy) Policy {
+	return PolicyFunc(func(c gemini.Certificate) (err error) {
+		var notValid error
+		for _, p := range policies {
+			if err = p.Authorise(c); err == nil {
+				return nil
+			}
+			if notValid == nil && errors.Is(err, ErrCertificateNotValid) {
+				notValid = err
+			}
+		}
+		if notValid != nil {
+			return notValid
+		}
+		if err == nil {
+			err = ErrNotAuthorised
+		}
+		return err
+	})
+}
+
+// Handler returns a handler that only passes requests to h if the client presents
+// a certificate that the policy allows. Requests without a certificate receive a 60,
+// requests with invalid certificates a 62, and unauthorised requests a 61. Denied
+// requests are logged as audit events.
+func Handler(policy Policy, h gemini.Handler) gemini.Handler {
+	return gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		if r.Certificate.ID == "" {
+			audit(r, gemini.CodeClientCertificateRequired, "no certificate")
+			w.SetHeader(gemini.CodeClientCertificateRequired, "client certificate required")
+			return
+		}
+		if r.Certificate.Error != "" {
+			audit(r, gemini.CodeClientCertificateNotValid, r.Certificate.Error)
+			w.SetHeader(gemini.CodeClientCertificateNotValid, r.Certificate.Error)
+			return
+		}
+		if err := policy.Authorise(r.Certificate); err != nil {
+			if errors.Is(err, ErrCertificateNotValid) {
+				audit(r, gemini.CodeClientCertificateNotValid, err.Error())
+				w.SetHeader(gemini.CodeClientCertificateNotValid, "certificate not valid")
+				return
+			}
+			audit(r, gemini.CodeClientCertificateNotAuthorised, err.Error())
+			w.SetHeader(gemini.CodeClientCertificateNotAuthorised, "not authorised")
+			return
+		}
+		h.ServeGemini(w, r)
+	})
+}
+
+// Middleware returns mux middleware that applies the policy, see Handler. Use it to
+// protect a group of routes, or a single route, e.g.:
+//
+//	admin := m.Group("/admin", auth.Middleware(roles.Require("admin")))
+//	admin.AddRoute("/users", usersHandler)
+func Middleware(policy Policy) mux.Middleware {
+	return func(next gemini.Handler) gemini.Handler {
+		return Handler(policy, next)
+	}
+}
+
+func audit(r *gemini.Request, code gemini.Code, reason string) {
+	log.Warn("auth: access denied",
+		log.String("url", r.URL.String()),
+		log.String("code", string(code)),
+		log.String("certificateID", r.Certificate.ID),
+		log.String("publicKeyID", r.Certificate.PublicKeyID),
+		log.String("commonName", r.Certificate.CommonName),
+		log.String("reason", strings.TrimPrefix(reason, "auth: ")))
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/cert"
+	"github.com/a-h/gemini/mux"
+)
+
+func TestHandler(t *testing.T) {
+	allowed := gemini.Certificate{ID: "allowed", PublicKeyID: "allowedKey"}
+	var tests = []struct {
+		name         string
+		policy       Policy
+		certificate  gemini.Certificate
+		expectedCode gemini.Code
+	}{
+		{
+			name:         "requests without a certificate receive a 60",
+			policy:       AllowAll,
+			expectedCode: gemini.CodeClientCertificateRequired,
+		},
+		{
+			name:         "requests with certificate errors receive a 62",
+			policy:       AllowAll,
+			certificate:  gemini.Certificate{ID: "expired", Error: "certificate has expired"},
+			expectedCode: gemini.CodeClientCertificateNotValid,
+		},
+		{
+			name:         "certificates in the allowlist are allowed",
+			policy:       NewAllowlist("allowed"),
+			certificate:  allowed,
+			expectedCode: gemini.CodeSuccess,
+		},
+		{
+			name:         "certificates can be allowed by public key",
+			policy:       NewAllowlist("allowedKey"),
+			certificate:  allowed,
+			expectedCode: gemini.CodeSuccess,
+		},
+		{
+			name:         "certificates not in the allowlist receive a 61",
+			policy:       NewAllowlist("other"),
+			certificate:  allowed,
+			expectedCode: gemini.CodeClientCertificateNotAuthorised,
+		},
+		{
+			name:         "certificates without a required role receive a 61",
+			policy:       NewRoles(map[string][]string{"allowed": {"editor"}}).Require("admin"),
+			certificate:  allowed,
+			expectedCode: gemini.CodeClientCertificateNotAuthorised,
+		},
+		{
+			name:         "certificates with any of the required roles are allowed",
+			policy:       NewRoles(map[string][]string{"allowed": {"editor"}}).Require("admin", "editor"),
+			certificate:  allowed,
+			expectedCode: gemini.CodeSuccess,
+		},
+		{
+			name:         "certificates not signed by the CA receive a 62",
+			policy:       CA(x509.NewCertPool()),
+			certificate:  allowed,
+			expectedCode: gemini.CodeClientCertificateNotValid,
+		},
+		{
+			name:         "all policies must allow access",
+			policy:       All(AllowAll, NewAllowlist("other")),
+			certificate:  allowed,
+			expectedCode: gemini.CodeClientCertificateNotAuthorised,
+		},
+		{
+			name:         "any policy can allow access",
+			policy:       Any(NewAllowlist("other"), NewAllowlist("allowed")),
+			certificate:  allowed,
+			expectedCode: gemini.CodeSuccess,
+		},
+		{
+			name:         "invalid certificates take precedence when no policy allows access",
+			policy:       Any(CA(x509.NewCertPool()), NewAllowlist("other")),
+			certificate:  allowed,
+			expectedCode: gemini.CodeClientCertificateNotValid,
+		},
+		{
+			name:         "authoriser functions can be used as policies",
+			policy:       Authoriser(func(certID, certKey string) bool { return certID == "allowed" }),
+			certificate:  allowed,
+			expectedCode: gemini.CodeSuccess,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := Handler(tt.policy, gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+				w.Write([]byte("OK"))
+			}))
+			r := &gemini.Request{
+				URL:         &url.URL{Scheme: "gemini", Host: "example.com", Path: "/"},
+				Certificate: tt.certificate,
+			}
+			resp, err := gemini.Record(r, h)
+			if err != nil {
+				t.Fatalf("failed to record request: %v", err)
+			}
+			if resp.Header.Code != tt.expectedCode {
+				t.Errorf("expected code %v, got %v", tt.expectedCode, resp.Header.Code)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	roles := NewRoles(map[string][]string{"alice": {"admin"}, "bob": {"editor"}})
+	ok := gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		w.Write([]byte("OK"))
+	})
+	m := mux.NewMux()
+	m.AddRoute("/", ok)
+	m.Group("/admin", Middleware(roles.Require("admin"))).AddRoute("/users", ok)
+	m.Group("", Middleware(roles.Require("editor"))).AddRoute("/posts", ok)
+
+	var tests = []struct {
+		path         string
+		certificate  gemini.Certificate
+		expectedCode gemini.Code
+	}{
+		{path: "/", expectedCode: gemini.CodeSuccess},
+		{path: "/admin/users", expectedCode: gemini.CodeClientCertificateRequired},
+		{path: "/admin/users", certificate: gemini.Certificate{ID: "bob"}, expectedCode: gemini.CodeClientCertificateNotAuthorised},
+		{path: "/admin/users", certificate: gemini.Certificate{ID: "alice"}, expectedCode: gemini.CodeSuccess},
+		{path: "/admin/users", certificate: gemini.Certificate{ID: "alice", Error: "certificate expired"}, expectedCode: gemini.CodeClientCertificateNotValid},
+		{path: "/posts", certificate: gemini.Certificate{ID: "alice"}, expectedCode: gemini.CodeClientCertificateNotAuthorised},
+		{path: "/posts", certificate: gemini.Certificate{ID: "bob"}, expectedCode: gemini.CodeSuccess},
+	}
+	for _, tt := range tests {
+		r := &gemini.Request{
+			Context:     context.Background(),
+			URL:         &url.URL{Scheme: "gemini", Host: "example.com", Path: tt.path},
+			Certificate: tt.certificate,
+		}
+		resp, err := gemini.Record(r, m)
+		if err != nil {
+			t.Fatalf("failed to record request: %v", err)
+		}
+		if resp.Header.Code != tt.expectedCode {
+			t.Errorf("%s %q: expected code %v, got %v", tt.path, tt.certificate.ID, tt.expectedCode, resp.Header.Code)
+		}
+	}
+}
+
+func TestCA(t *testing.T) {
+	ca, err := cert.NewCA(cert.Options{CommonName: "Team CA", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	signed, _, err := ca.SignClient(cert.Options{CommonName: "alice", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to sign client certificate: %v", err)
+	}
+	selfSigned, _, err := cert.GenerateClient(cert.Options{CommonName: "mallory", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to generate client certificate: %v", err)
+	}
+	policy := CA(ca.CertPool())
+	if err = policy.Authorise(certificate(t, signed)); err != nil {
+		t.Errorf("expected certificate signed by the CA to be allowed, got %v", err)
+	}
+	if err = policy.Authorise(certificate(t, selfSigned)); err == nil {
+		t.Errorf("expected self-signed certificate to be rejected")
+	}
+}
+
+func certificate(t *testing.T, certPEM []byte) gemini.Certificate {
+	b, _ := pem.Decode(certPEM)
+	if b == nil {
+		t.Fatalf("failed to decode certificate PEM")
+	}
+	leaf, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return gemini.NewCertificate([]*x509.Certificate{leaf}, time.Now())
+}
+
+func TestLoadRoles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_auth")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "roles")
+
+	write := func(s string) {
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatalf("failed to write roles: %v", err)
+		}
+	}
+	write("# Alice\nalice admin,editor\n\nbob editor\n")
+	roles, err := LoadRoles(path)
+	if err != nil {
+		t.Fatalf("failed to load roles: %v", err)
+	}
+	alice := gemini.Certificate{ID: "alice"}
+	if !roles.Has(alice, "admin") {
+		t.Errorf("expected alice to be an admin, got %v", roles.Get(alice))
+	}
+
+	write("alice editor\n")
+	if err = roles.Reload(); err != nil {
+		t.Fatalf("failed to reload roles: %v", err)
+	}
+	if roles.Has(alice, "admin") {
+		t.Errorf("expected alice not to be an admin after reload, got %v", roles.Get(alice))
+	}
+
+	write("alice editor extra\n")
+	if err = roles.Reload(); err == nil {
+		t.Errorf("expected an error reloading an invalid file")
+	}
+	if !roles.Has(alice, "editor") {
+		t.Errorf("expected previous roles to be retained after a failed reload, got %v", roles.Get(alice))
+	}
+
+	allowlist, err := LoadAllowlist(path)
+	if err == nil {
+		t.Errorf("expected an error loading an invalid allowlist, got %v", allowlist)
+	}
+}
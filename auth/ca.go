@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/a-h/gemini"
+)
+
+// CA returns a Policy that allows certificates signed by one of the roots, e.g. a team
+// certificate authority created with cert.NewCA. Certificates must be valid for client
+// authentication.
+func CA(roots *x509.CertPool) Policy {
+	return PolicyFunc(func(c gemini.Certificate) error {
+		if c.Leaf == nil {
+			return fmt.Errorf("%w: certificate not parsed", ErrCertificateNotValid)
+		}
+		intermediates := x509.NewCertPool()
+		for _, ic := range c.Chain {
+			if ic != c.Leaf {
+				intermediates.AddCert(ic)
+			}
+		}
+		_, err := c.Leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   time.Now(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCertificateNotValid, err)
+		}
+		return nil
+	})
+}
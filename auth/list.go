@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/a-h/gemini"
+)
+
+// list maps certificate fingerprints to values. It can be reloaded from a file where
+// each line contains a fingerprint, optionally followed by whitespace and a comma
+// separated list of values. Blank lines and lines starting with # are ignored.
+type list struct {
+	path string
+	m    sync.RWMutex
+	fp   map[string][]string
+}
+
+func newList(fp map[string][]string) *list {
+	l := &list{fp: make(map[string][]string, len(fp))}
+	for k, v := range fp {
+		l.fp[k] = append([]string{}, v...)
+	}
+	return l
+}
+
+func loadList(path string) (l *list, err error) {
+	l = &list{path: path}
+	err = l.reload()
+	return
+}
+
+func (l *list) reload() (err error) {
+	if l.path == "" {
+		return
+	}
+	f, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("auth: failed to open %q: %w", l.path, err)
+	}
+	defer f.Close()
+	fp, err := parseList(f)
+	if err != nil {
+		return fmt.Errorf("auth: failed to read %q: %w", l.path, err)
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.fp = fp
+	return
+}
+
+func parseList(r io.Reader) (fp map[string][]string, err error) {
+	fp = make(map[string][]string)
+	s := bufio.NewScanner(r)
+	for lineNumber := 1; s.Scan(); lineNumber++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a fingerprint and optional comma separated values, got %q", lineNumber, line)
+		}
+		var values []string
+		if len(fields) == 2 {
+			for _, v := range strings.Split(fields[1], ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+		fp[fields[0]] = append(fp[fields[0]], values...)
+	}
+	err = s.Err()
+	return
+}
+
+// get returns the values for the certificate, matching either the certificate
+// fingerprint or the public key fingerprint.
+func (l *list) get(c gemini.Certificate) (values []string, ok bool) {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	for _, id := range []string{c.ID, c.PublicKeyID} {
+		if id == "" {
+			continue
+		}
+		if v, found := l.fp[id]; found {
+			values = append(values, v...)
+			ok = true
+		}
+	}
+	sort.Strings(values)
+	return
+}
+
+// Allowlist is a Policy that allows certificates whose fingerprint or public key
+// fingerprint is in the list.
+type Allowlist struct {
+	l *list
+}
+
+// NewAllowlist creates an Allowlist containing the fingerprints.
+func NewAllowlist(fingerprints ...string) *Allowlist {
+	fp := make(map[string][]string, len(fingerprints))
+	for _, f := range fingerprints {
+		fp[f] = nil
+	}
+	return &Allowlist{l: newList(fp)}
+}
+
+// LoadAllowlist loads an Allowlist from a file containing one fingerprint per line.
+// Blank lines and lines starting with # are ignored.
+func LoadAllowlist(path string) (a *Allowlist, err error) {
+	l, err := loadList(path)
+	if err != nil {
+		return
+	}
+	a = &Allowlist{l: l}
+	return
+}
+
+// Reload the Allowlist from its file. If the file can't be read, the previous
+// list is retained. Allowlists not loaded from a file are unchanged.
+func (a *Allowlist) Reload() error {
+	return a.l.reload()
+}
+
+// Authorise implements Policy.
+func (a *Allowlist) Authorise(c gemini.Certificate) error {
+	if _, ok := a.l.get(c); ok {
+		return nil
+	}
+	return ErrNotAuthorised
+}
+
+// Roles maps certificate fingerprints to roles.
+type Roles struct {
+	l *list
+}
+
+// NewRoles creates Roles from a map of certificate fingerprints to roles.
+func NewRoles(fingerprintToRoles map[string][]string) *Roles {
+	return &Roles{l: newList(fingerprintToRoles)}
+}
+
+// LoadRoles loads Roles from a file where each line contains a fingerprint followed
+// by a comma separated list of roles, e.g.:
+//
+//	# Alice
+//	8ZyGVAcZr3cE7JhX6b1kNf8M5KRBu6YBrmO5T6nBBMQ= admin,editor
+//
+// Blank lines and lines starting with # are ignored.
+func LoadRoles(path string) (r *Roles, err error) {
+	l, err := loadList(path)
+	if err != nil {
+		return
+	}
+	r = &Roles{l: l}
+	return
+}
+
+// Reload the Roles from the file. If the file can't be read, the previous
+// roles are retained. Roles not loaded from a file are unchanged.
+func (r *Roles) Reload() error {
+	return r.l.reload()
+}
+
+// Get the roles assigned to the certificate, sorted by name.
+func (r *Roles) Get(c gemini.Certificate) (roles []string) {
+	roles, _ = r.l.get(c)
+	return
+}
+
+// Has returns true if the certificate has been assigned the role.
+func (r *Roles) Has(c gemini.Certificate, role string) bool {
+	for _, rr := range r.Get(c) {
+		if rr == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Require returns a Policy that allows certificates that have been assigned at
+// least one of the roles. Use it with Handler or Middleware to protect routes, e.g.:
+//
+//	m.AddRoute("/admin", auth.Handler(roles.Require("admin"), adminHandler))
+//	m.Group("/editor", auth.Middleware(roles.Require("admin", "editor"))).AddRoute("/posts", postsHandler)
+func (r *Roles) Require(roles ...string) Policy {
+	return PolicyFunc(func(c gemini.Certificate) error {
+		for _, role := range roles {
+			if r.Has(c, role) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: requires role %s", ErrNotAuthorised, strings.Join(roles, " or "))
+	})
+}
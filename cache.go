@@ -0,0 +1,295 @@
+package gemini
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures a Cache.
+type CacheOptions struct {
+	// MaxSize is the maximum total size of the cache in bytes. Defaults to DefaultCacheMaxSize.
+	MaxSize int64
+	// MaxFileSize is the size in bytes of the largest file that is cached. Larger files are
+	// read from the underlying FileSystem. Defaults to DefaultCacheMaxFileSize.
+	MaxFileSize int64
+	// CheckInterval is how long cached files and directories are used before checking that
+	// their modification time and size haven't changed. Files that don't exist are also
+	// remembered for the interval. Zero checks on every request.
+	CheckInterval time.Duration
+}
+
+const (
+	// DefaultCacheMaxSize is the default maximum total size of a Cache, 64MiB.
+	DefaultCacheMaxSize = 64 << 20
+	// DefaultCacheMaxFileSize is the default size of the largest file stored in a Cache, 1MiB.
+	DefaultCacheMaxFileSize = 1 << 20
+)
+
+// fileInfoSize is the approximate size of a directory entry, used to limit the size of the cache.
+const fileInfoSize = 128
+
+// CacheStats are the metrics of a Cache.
+type CacheStats struct {
+	// Hits is the number of times a file or directory was served from the cache.
+	Hits uint64
+	// Misses is the number of times a file or directory was read from the underlying FileSystem.
+	Misses uint64
+	// Evictions is the number of entries removed to keep the cache within its maximum size.
+	Evictions uint64
+	// Entries is the number of files and directories in the cache.
+	Entries int
+	// Size is the total size of the entries in the cache, in bytes.
+	Size int64
+}
+
+// Cache is a FileSystem that keeps the contents of small files, and the entries of
+// directories, of another FileSystem in memory. The least recently used entries are
+// removed when the cache is full.
+//
+// Cached entries are checked against the modification time and size of the file before
+// they're used, see CacheOptions.CheckInterval. Editing a file doesn't change the
+// modification time of its directory, so directory listings that show sizes and dates
+// are refreshed when entries are added or removed, or when the cache is invalidated. To
+// invalidate entries when files change, e.g. from a file watcher, use Invalidate or Purge.
+type Cache struct {
+	fsys FileSystem
+	opts CacheOptions
+	now  func() time.Time
+
+	m       sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+	stats   CacheStats
+}
+
+// NewCache creates a Cache of fsys.
+func NewCache(fsys FileSystem, opts CacheOptions) *Cache {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultCacheMaxSize
+	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = DefaultCacheMaxFileSize
+	}
+	return &Cache{
+		fsys:    fsys,
+		opts:    opts,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// cacheEntry is a cached file, directory or missing file. Apart from checked, entries
+// aren't modified after they're created.
+type cacheEntry struct {
+	name    string
+	info    os.FileInfo
+	data    []byte
+	dir     []os.FileInfo
+	err     error
+	checked time.Time
+}
+
+func (e *cacheEntry) size() (n int64) {
+	n = int64(len(e.name)+len(e.data)) + fileInfoSize
+	for _, fi := range e.dir {
+		n += int64(len(fi.Name())) + fileInfoSize
+	}
+	return
+}
+
+// matches returns true if the file hasn't changed since it was cached.
+func (e *cacheEntry) matches(info os.FileInfo) bool {
+	return e.info != nil &&
+		e.info.IsDir() == info.IsDir() &&
+		e.info.Size() == info.Size() &&
+		e.info.ModTime().Equal(info.ModTime())
+}
+
+func (e *cacheEntry) open() (File, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &cachedFile{entry: e, Reader: bytes.NewReader(e.data)}, nil
+}
+
+// Open implements FileSystem.
+func (c *Cache) Open(name string) (File, error) {
+	key := path.Clean("/" + name)
+	now := c.now()
+	c.m.Lock()
+	e, cached := c.get(key)
+	fresh := cached && now.Sub(e.checked) < c.opts.CheckInterval
+	if fresh {
+		c.stats.Hits++
+	}
+	c.m.Unlock()
+	if fresh {
+		return e.open()
+	}
+
+	f, err := c.fsys.Open(name)
+	if err != nil {
+		c.m.Lock()
+		defer c.m.Unlock()
+		c.stats.Misses++
+		c.remove(key)
+		if os.IsNotExist(err) && c.opts.CheckInterval > 0 {
+			c.add(&cacheEntry{name: key, err: err, checked: now})
+		}
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if cached && e.matches(info) {
+		f.Close()
+		c.m.Lock()
+		c.stats.Hits++
+		e.checked = now
+		c.m.Unlock()
+		return e.open()
+	}
+
+	c.m.Lock()
+	c.stats.Misses++
+	c.remove(key)
+	c.m.Unlock()
+	if !info.IsDir() && info.Size() > c.opts.MaxFileSize {
+		return f, nil
+	}
+	defer f.Close()
+	e = &cacheEntry{name: key, info: info, checked: now}
+	if info.IsDir() {
+		if e.dir, err = f.Readdir(-1); err != nil {
+			return nil, err
+		}
+	} else {
+		if e.data, err = ioutil.ReadAll(io.LimitReader(f, c.opts.MaxFileSize+1)); err != nil {
+			return nil, err
+		}
+		if int64(len(e.data)) != info.Size() {
+			// The file changed while it was being read, so serve what was read without caching it.
+			return e.open()
+		}
+	}
+	c.m.Lock()
+	c.add(e)
+	c.m.Unlock()
+	return e.open()
+}
+
+// EvalSymlinks implements SymlinkFileSystem, so that the symlink policy of FileSystemHandler
+// applies to the underlying FileSystem.
+func (c *Cache) EvalSymlinks(name string) (resolved string, inRoot bool, err error) {
+	if sfs, ok := c.fsys.(SymlinkFileSystem); ok {
+		return sfs.EvalSymlinks(name)
+	}
+	return path.Clean("/" + name), true, nil
+}
+
+// Invalidate removes the named file or directory from the cache.
+func (c *Cache) Invalidate(name string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.remove(path.Clean("/" + name))
+}
+
+// Purge removes all entries from the cache.
+func (c *Cache) Purge() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+// Stats returns the cache metrics.
+func (c *Cache) Stats() (s CacheStats) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	s = c.stats
+	s.Entries = len(c.entries)
+	s.Size = c.size
+	return
+}
+
+// get returns the entry and marks it as recently used. The caller must hold the lock.
+func (c *Cache) get(key string) (e *cacheEntry, ok bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry), true
+}
+
+// add the entry to the cache, evicting the least recently used entries to make space for
+// it. The caller must hold the lock.
+func (c *Cache) add(e *cacheEntry) {
+	size := e.size()
+	if size > c.opts.MaxSize {
+		return
+	}
+	c.remove(e.name)
+	for c.size+size > c.opts.MaxSize {
+		c.remove(c.lru.Back().Value.(*cacheEntry).name)
+		c.stats.Evictions++
+	}
+	c.entries[e.name] = c.lru.PushFront(e)
+	c.size += size
+}
+
+// remove the entry from the cache, if it's present. The caller must hold the lock.
+func (c *Cache) remove(key string) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.lru.Remove(elem)
+	delete(c.entries, key)
+	c.size -= elem.Value.(*cacheEntry).size()
+}
+
+// cachedFile is a File that reads from a cache entry.
+type cachedFile struct {
+	*bytes.Reader
+	entry  *cacheEntry
+	offset int
+}
+
+func (f *cachedFile) Close() error {
+	return nil
+}
+
+func (f *cachedFile) Stat() (os.FileInfo, error) {
+	return f.entry.info, nil
+}
+
+func (f *cachedFile) Readdir(count int) (entries []os.FileInfo, err error) {
+	if !f.entry.info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.entry.name, Err: errNotDir}
+	}
+	remaining := f.entry.dir[f.offset:]
+	if count <= 0 {
+		f.offset = len(f.entry.dir)
+		return append([]os.FileInfo(nil), remaining...), nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	f.offset += count
+	return append([]os.FileInfo(nil), remaining[:count]...), nil
+}
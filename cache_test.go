@@ -0,0 +1,223 @@
+package gemini
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// countingFileSystem counts the files opened from the underlying FileSystem.
+type countingFileSystem struct {
+	FileSystem
+	opened int
+}
+
+func (c *countingFileSystem) Open(name string) (File, error) {
+	c.opened++
+	return c.FileSystem.Open(name)
+}
+
+func readCached(t *testing.T, c *Cache, name string) string {
+	t.Helper()
+	f, err := c.Open(name)
+	if err != nil {
+		t.Fatalf("unexpected error opening %q: %v", name, err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected error reading %q: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestCache(t *testing.T) {
+	modTime := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.gmi": &fstest.MapFile{Data: []byte("# Home\n"), ModTime: modTime},
+	}
+	c := NewCache(FS(fsys), CacheOptions{})
+
+	if actual := readCached(t, c, "/index.gmi"); actual != "# Home\n" {
+		t.Errorf("expected %q, got %q", "# Home\n", actual)
+	}
+	if actual := readCached(t, c, "index.gmi"); actual != "# Home\n" {
+		t.Errorf("expected %q, got %q", "# Home\n", actual)
+	}
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 1 || s.Entries != 1 {
+		t.Errorf("expected 1 hit, 1 miss and 1 entry, got %+v", s)
+	}
+
+	fsys["index.gmi"] = &fstest.MapFile{Data: []byte("# Updated\n"), ModTime: modTime.Add(time.Second)}
+	if actual := readCached(t, c, "/index.gmi"); actual != "# Updated\n" {
+		t.Errorf("expected changes to be read, got %q", actual)
+	}
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 2 || s.Entries != 1 {
+		t.Errorf("expected 1 hit, 2 misses and 1 entry, got %+v", s)
+	}
+
+	delete(fsys, "index.gmi")
+	if _, err := c.Open("/index.gmi"); err == nil {
+		t.Errorf("expected deleted files to be removed from the cache")
+	}
+	if s := c.Stats(); s.Entries != 0 || s.Size != 0 {
+		t.Errorf("expected an empty cache, got %+v", s)
+	}
+}
+
+func TestCacheCheckInterval(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.gmi": &fstest.MapFile{Data: []byte("# Home\n")},
+	}
+	underlying := &countingFileSystem{FileSystem: FS(fsys)}
+	c := NewCache(underlying, CacheOptions{CheckInterval: time.Minute})
+	now := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	readCached(t, c, "/index.gmi")
+	fsys["index.gmi"] = &fstest.MapFile{Data: []byte("# Updated\n"), ModTime: now}
+	if actual := readCached(t, c, "/index.gmi"); actual != "# Home\n" {
+		t.Errorf("expected the cached file to be used within the check interval, got %q", actual)
+	}
+	if _, err := c.Open("/missing.gmi"); err == nil {
+		t.Errorf("expected an error opening a missing file")
+	}
+	if _, err := c.Open("/missing.gmi"); err == nil {
+		t.Errorf("expected an error opening a missing file")
+	}
+	if underlying.opened != 2 {
+		t.Errorf("expected 2 files to be opened, got %d", underlying.opened)
+	}
+
+	now = now.Add(time.Minute)
+	if actual := readCached(t, c, "/index.gmi"); actual != "# Updated\n" {
+		t.Errorf("expected the file to be checked after the interval, got %q", actual)
+	}
+	if underlying.opened != 3 {
+		t.Errorf("expected 3 files to be opened, got %d", underlying.opened)
+	}
+}
+
+func TestCacheLimits(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.gmi":     &fstest.MapFile{Data: make([]byte, 400)},
+		"b.gmi":     &fstest.MapFile{Data: make([]byte, 400)},
+		"large.gmi": &fstest.MapFile{Data: make([]byte, 2048)},
+	}
+	c := NewCache(FS(fsys), CacheOptions{MaxSize: 1024, MaxFileSize: 1024})
+
+	if actual := readCached(t, c, "/large.gmi"); len(actual) != 2048 {
+		t.Errorf("expected large files to be read in full, got %d bytes", len(actual))
+	}
+	if s := c.Stats(); s.Entries != 0 {
+		t.Errorf("expected large files not to be cached, got %+v", s)
+	}
+
+	readCached(t, c, "/a.gmi")
+	readCached(t, c, "/b.gmi")
+	if s := c.Stats(); s.Entries != 1 || s.Evictions != 1 || s.Size > 1024 {
+		t.Errorf("expected the least recently used file to be evicted, got %+v", s)
+	}
+	readCached(t, c, "/b.gmi")
+	if s := c.Stats(); s.Hits != 1 {
+		t.Errorf("expected the most recently used file to be kept, got %+v", s)
+	}
+}
+
+func TestCacheDirectories(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/a.gmi": &fstest.MapFile{Data: []byte("# A\n")},
+		"dir/b.gmi": &fstest.MapFile{Data: []byte("# B\n")},
+		"dir/c.gmi": &fstest.MapFile{Data: []byte("# C\n")},
+	}
+	c := NewCache(FS(fsys), CacheOptions{})
+	for i := 0; i < 2; i++ {
+		f, err := c.Open("/dir/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		first, err := f.Readdir(2)
+		if err != nil || len(first) != 2 {
+			t.Fatalf("expected 2 entries, got %d: %v", len(first), err)
+		}
+		rest, err := f.Readdir(2)
+		if err != nil || len(rest) != 1 {
+			t.Fatalf("expected 1 entry, got %d: %v", len(rest), err)
+		}
+		if _, err = f.Readdir(2); err != io.EOF {
+			t.Errorf("expected EOF, got %v", err)
+		}
+		f.Close()
+	}
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 1 {
+		t.Errorf("expected the directory to be cached, got %+v", s)
+	}
+
+	c.Invalidate("/dir")
+	if s := c.Stats(); s.Entries != 0 {
+		t.Errorf("expected the directory to be invalidated, got %+v", s)
+	}
+	readCached(t, c, "/dir/a.gmi")
+	readCached(t, c, "/dir/b.gmi")
+	c.Purge()
+	if s := c.Stats(); s.Entries != 0 || s.Size != 0 {
+		t.Errorf("expected the cache to be purged, got %+v", s)
+	}
+}
+
+func TestCacheFileSystemHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		".meta":     &fstest.MapFile{Data: []byte("lang = \"en\"\n")},
+		"index.gmi": &fstest.MapFile{Data: []byte("# Home\n")},
+		"dir/a.gmi": &fstest.MapFile{Data: []byte("# A\n")},
+	}
+	underlying := &countingFileSystem{FileSystem: FS(fsys)}
+	h := FileSystemHandlerWithMetadata(NewCache(underlying, CacheOptions{CheckInterval: time.Minute}), Metadata{})
+	var tests = []struct {
+		url            string
+		expectedHeader Header
+		expectedBody   string
+	}{
+		{
+			url:            "/",
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/gemini; charset=utf-8; lang=en"},
+			expectedBody:   "# Home\n",
+		},
+		{
+			url:            "/dir/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /dir/\n\n=> ../\n=> a.gmi\n",
+		},
+	}
+	for i := 0; i < 2; i++ {
+		for _, tt := range tests {
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Path: tt.url},
+			}
+			resp, err := Record(r, h)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedHeader.Code != resp.Header.Code || tt.expectedHeader.Meta != resp.Header.Meta {
+				t.Errorf("%s: expected header %v, got %v", tt.url, tt.expectedHeader, *resp.Header)
+			}
+			bdy, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if tt.expectedBody != string(bdy) {
+				t.Errorf("%s: expected\n%v\nactual\n%v", tt.url, tt.expectedBody, string(bdy))
+			}
+		}
+	}
+	opened := underlying.opened
+	Record(&Request{Context: context.Background(), URL: &url.URL{Path: "/"}}, h)
+	if underlying.opened != opened {
+		t.Errorf("expected cached requests not to open files, but %d were opened", underlying.opened-opened)
+	}
+}
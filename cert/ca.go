@@ -0,0 +1,198 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// Options used to create a certificate.
+type Options struct {
+	Organization string
+	CommonName   string
+	// Hosts are added to the certificate's subject alternative names. IP addresses
+	// are added as IP SANs, everything else is added as a DNS name.
+	Hosts    []string
+	Duration time.Duration
+	// KeyType of the certificate's private key. Defaults to DefaultKeyType.
+	KeyType KeyType
+}
+
+// SplitHosts splits a comma separated list of hosts, ignoring whitespace and empty entries.
+func SplitHosts(hosts string) (split []string) {
+	for _, h := range strings.Split(hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			split = append(split, h)
+		}
+	}
+	return
+}
+
+// CA is a certificate authority that signs server and client certificates.
+type CA struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+// NewCA creates a self-signed root certificate authority.
+func NewCA(opts Options) (ca *CA, err error) {
+	key, err := GenerateKey(opts.KeyType)
+	if err != nil {
+		return
+	}
+	template, err := newTemplate(opts)
+	if err != nil {
+		return
+	}
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = nil
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		err = fmt.Errorf("cert: failed to create CA certificate: %w", err)
+		return
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		err = fmt.Errorf("cert: failed to parse CA certificate: %w", err)
+		return
+	}
+	return &CA{Certificate: cert, Key: key}, nil
+}
+
+// ErrNotCA is returned when loading a CA from a certificate that can't sign other certificates.
+var ErrNotCA = errors.New("cert: certificate is not a certificate authority")
+
+// ErrKeyMismatch is returned when loading a CA whose private key doesn't match the public
+// key of its certificate.
+var ErrKeyMismatch = errors.New("cert: private key does not match the certificate")
+
+// LoadCA loads a certificate authority from PEM encoded certificate and key data.
+func LoadCA(certPEM, keyPEM []byte) (ca *CA, err error) {
+	certs, err := DecodeCertificates(certPEM)
+	if err != nil {
+		return
+	}
+	key, err := DecodeKey(keyPEM)
+	if err != nil {
+		return
+	}
+	if !certs[0].IsCA {
+		err = ErrNotCA
+		return
+	}
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(certs[0].PublicKey) {
+		err = ErrKeyMismatch
+		return
+	}
+	return &CA{Certificate: certs[0], Key: key}, nil
+}
+
+// PEM encodes the CA's certificate and key.
+func (ca *CA) PEM() (cert, key []byte, err error) {
+	cert = EncodeCertificate(ca.Certificate.Raw)
+	key, err = EncodeKey(ca.Key)
+	return
+}
+
+// CertPool returns a pool containing the CA certificate, for verifying certificates it has signed.
+func (ca *CA) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate)
+	return pool
+}
+
+// SignServer creates a server certificate signed by the CA. The CA certificate is not
+// included in the returned certificate PEM.
+func (ca *CA) SignServer(opts Options) (cert, key []byte, err error) {
+	return create(opts, x509.ExtKeyUsageServerAuth, ca.Certificate, ca.Key)
+}
+
+// SignClient creates a client certificate, suitable for use as a Gemini client identity, signed by the CA.
+func (ca *CA) SignClient(opts Options) (cert, key []byte, err error) {
+	return create(opts, x509.ExtKeyUsageClientAuth, ca.Certificate, ca.Key)
+}
+
+// GenerateServer creates a self-signed server certificate.
+func GenerateServer(opts Options) (cert, key []byte, err error) {
+	return create(opts, x509.ExtKeyUsageServerAuth, nil, nil)
+}
+
+// GenerateClient creates a self-signed client certificate.
+func GenerateClient(opts Options) (cert, key []byte, err error) {
+	return create(opts, x509.ExtKeyUsageClientAuth, nil, nil)
+}
+
+// create a certificate with a new key. If parent is nil, the certificate is self-signed.
+func create(opts Options, usage x509.ExtKeyUsage, parent *x509.Certificate, parentKey crypto.Signer) (certPEM, keyPEM []byte, err error) {
+	key, err := GenerateKey(opts.KeyType)
+	if err != nil {
+		return
+	}
+	template, err := newTemplate(opts)
+	if err != nil {
+		return
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	// ECDSA, ED25519 and RSA subject keys should have the DigitalSignature
+	// KeyUsage bits set in the x509.Certificate template. Only RSA keys are
+	// used for key encipherment in TLS.
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, isRSA := key.(*rsa.PrivateKey); isRSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		err = fmt.Errorf("cert: failed to create certificate: %w", err)
+		return
+	}
+	certPEM = EncodeCertificate(der)
+	keyPEM, err = EncodeKey(key)
+	return
+}
+
+func newTemplate(opts Options) (template *x509.Certificate, err error) {
+	if opts.Duration <= 0 {
+		err = errors.New("cert: duration must be positive")
+		return
+	}
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		err = fmt.Errorf("cert: failed to generate serial number: %w", err)
+		return
+	}
+	template = &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName: opts.CommonName,
+		},
+		// Give some flexibility to handle clock adjustments.
+		NotBefore:             time.Now().Add(time.Hour * -24),
+		NotAfter:              time.Now().Add(opts.Duration),
+		BasicConstraintsValid: true,
+	}
+	if opts.Organization != "" {
+		template.Subject.Organization = []string{opts.Organization}
+	}
+	for _, h := range opts.Hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	return
+}
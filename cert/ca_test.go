@@ -0,0 +1,168 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCASigning(t *testing.T) {
+	for _, kt := range KeyTypes {
+		kt := kt
+		t.Run(string(kt), func(t *testing.T) {
+			if testing.Short() && kt == KeyTypeRSA4096 {
+				t.Skip("skipping slow key generation")
+			}
+			ca, err := NewCA(Options{Organization: "Team", CommonName: "Team CA", Duration: time.Hour, KeyType: kt})
+			if err != nil {
+				t.Fatalf("failed to create CA: %v", err)
+			}
+			if !ca.Certificate.IsCA {
+				t.Errorf("expected CA certificate to be a CA")
+			}
+
+			// Round trip the CA through PEM.
+			caCertPEM, caKeyPEM, err := ca.PEM()
+			if err != nil {
+				t.Fatalf("failed to encode CA: %v", err)
+			}
+			ca, err = LoadCA(caCertPEM, caKeyPEM)
+			if err != nil {
+				t.Fatalf("failed to load CA: %v", err)
+			}
+
+			serverCert, serverKey, err := ca.SignServer(Options{CommonName: "example.com", Hosts: []string{"example.com", "127.0.0.1"}, Duration: time.Hour, KeyType: kt})
+			if err != nil {
+				t.Fatalf("failed to sign server certificate: %v", err)
+			}
+			server := parseKeyPair(t, serverCert, serverKey)
+			if !reflect.DeepEqual(server.DNSNames, []string{"example.com"}) {
+				t.Errorf("expected DNS SANs [example.com], got %v", server.DNSNames)
+			}
+			if len(server.IPAddresses) != 1 || server.IPAddresses[0].String() != "127.0.0.1" {
+				t.Errorf("expected IP SANs [127.0.0.1], got %v", server.IPAddresses)
+			}
+			_, err = server.Verify(x509.VerifyOptions{
+				DNSName:   "example.com",
+				Roots:     ca.CertPool(),
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			if err != nil {
+				t.Errorf("failed to verify server certificate: %v", err)
+			}
+
+			clientCert, clientKey, err := ca.SignClient(Options{CommonName: "user", Duration: time.Hour, KeyType: kt})
+			if err != nil {
+				t.Fatalf("failed to sign client certificate: %v", err)
+			}
+			client := parseKeyPair(t, clientCert, clientKey)
+			if client.Subject.CommonName != "user" {
+				t.Errorf("expected common name %q, got %q", "user", client.Subject.CommonName)
+			}
+			_, err = client.Verify(x509.VerifyOptions{
+				Roots:     ca.CertPool(),
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			if err != nil {
+				t.Errorf("failed to verify client certificate: %v", err)
+			}
+			_, err = client.Verify(x509.VerifyOptions{
+				Roots:     ca.CertPool(),
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			if err == nil {
+				t.Errorf("expected client certificate to be invalid for server authentication")
+			}
+		})
+	}
+}
+
+func parseKeyPair(t *testing.T, certPEM, keyPEM []byte) *x509.Certificate {
+	t.Helper()
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatalf("failed to load key pair: %v", err)
+	}
+	certs, err := DecodeCertificates(certPEM)
+	if err != nil {
+		t.Fatalf("failed to decode certificate: %v", err)
+	}
+	return certs[0]
+}
+
+func TestGenerate(t *testing.T) {
+	certPEM, keyPEM, err := Generate("org", "example.com", "example.com, localhost,::1", time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert := parseKeyPair(t, certPEM, keyPEM)
+	if cert.Subject.CommonName != "example.com" {
+		t.Errorf("expected common name %q, got %q", "example.com", cert.Subject.CommonName)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"example.com", "localhost"}) {
+		t.Errorf("expected DNS SANs [example.com localhost], got %v", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != "::1" {
+		t.Errorf("expected IP SANs [::1], got %v", cert.IPAddresses)
+	}
+}
+
+func TestLoadCARejectsLeafCertificates(t *testing.T) {
+	certPEM, keyPEM, err := GenerateServer(Options{CommonName: "example.com", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = LoadCA(certPEM, keyPEM)
+	if !errors.Is(err, ErrNotCA) {
+		t.Errorf("expected ErrNotCA, got %v", err)
+	}
+}
+
+func TestLoadCARejectsMismatchedKeys(t *testing.T) {
+	ca, err := NewCA(Options{CommonName: "CA", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, err := NewCA(Options{CommonName: "Other CA", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	certPEM, keyPEM, err := ca.PEM()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, otherKeyPEM, err := other.PEM()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = LoadCA(certPEM, keyPEM); err != nil {
+		t.Errorf("unexpected error loading a CA with its own key: %v", err)
+	}
+	if _, err = LoadCA(certPEM, otherKeyPEM); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("expected ErrKeyMismatch, got %v", err)
+	}
+}
+
+func TestParseKeyType(t *testing.T) {
+	var tests = []struct {
+		input       string
+		expected    KeyType
+		expectedErr error
+	}{
+		{input: "", expected: DefaultKeyType},
+		{input: "ECDSA-P384", expected: KeyTypeECDSAP384},
+		{input: "ed25519", expected: KeyTypeEd25519},
+		{input: "dsa", expectedErr: ErrUnknownKeyType},
+	}
+	for _, tt := range tests {
+		actual, err := ParseKeyType(tt.input)
+		if !errors.Is(err, tt.expectedErr) {
+			t.Errorf("%q: expected error %v, got %v", tt.input, tt.expectedErr, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package cert
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+)
+
+// Fingerprint returns the base64 encoded SHA-256 hash of the DER encoded certificate.
+// It's used as the ID of client certificates by the Gemini server, and to pin server
+// certificates in the Gemini client.
+func Fingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// PublicKeyFingerprint returns the base64 encoded SHA-256 hash of the certificate's
+// SubjectPublicKeyInfo. Unlike Fingerprint, it stays the same when a certificate is
+// re-issued for the same key.
+func PublicKeyFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
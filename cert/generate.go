@@ -0,0 +1,18 @@
+package cert
+
+import (
+	"time"
+)
+
+// Generate a pair of keys. These keys can be loaded with
+// cert, err = tls.LoadX509KeyPair("cert.pem", "key.pem")
+// hosts is a comma separated list of DNS names and IP addresses.
+func Generate(organization, commonName, hosts string, duration time.Duration) (cert, key []byte, err error) {
+	return GenerateServer(Options{
+		Organization: organization,
+		CommonName:   commonName,
+		Hosts:        SplitHosts(hosts),
+		Duration:     duration,
+		KeyType:      KeyTypeECDSAP256,
+	})
+}
@@ -0,0 +1,148 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeyType is the algorithm used to generate a private key.
+type KeyType string
+
+const (
+	KeyTypeECDSAP256 KeyType = "ecdsa-p256"
+	KeyTypeECDSAP384 KeyType = "ecdsa-p384"
+	KeyTypeEd25519   KeyType = "ed25519"
+	KeyTypeRSA2048   KeyType = "rsa-2048"
+	KeyTypeRSA4096   KeyType = "rsa-4096"
+)
+
+// DefaultKeyType is used when no KeyType is specified.
+const DefaultKeyType = KeyTypeECDSAP256
+
+// KeyTypes lists the supported key types.
+var KeyTypes = []KeyType{KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeEd25519, KeyTypeRSA2048, KeyTypeRSA4096}
+
+// ErrUnknownKeyType is returned when a key type is not supported.
+var ErrUnknownKeyType = errors.New("cert: unknown key type")
+
+// ParseKeyType parses a key type name, e.g. "ecdsa-p256". Matching is case insensitive.
+func ParseKeyType(s string) (kt KeyType, err error) {
+	if s == "" {
+		return DefaultKeyType, nil
+	}
+	for _, kt := range KeyTypes {
+		if strings.EqualFold(string(kt), s) {
+			return kt, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownKeyType, s)
+}
+
+// GenerateKey creates a new private key of the given type.
+func GenerateKey(kt KeyType) (key crypto.Signer, err error) {
+	switch kt {
+	case "", KeyTypeECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case KeyTypeRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownKeyType, kt)
+	}
+	if err != nil {
+		err = fmt.Errorf("cert: failed to generate private key: %w", err)
+	}
+	return
+}
+
+// EncodeKey encodes a private key as a PKCS #8 "PRIVATE KEY" PEM block.
+func EncodeKey(key crypto.PrivateKey) (keyPEM []byte, err error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		err = fmt.Errorf("cert: failed to marshal private key: %w", err)
+		return
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return
+}
+
+// ErrNoPEMData is returned when PEM data was expected, but not found.
+var ErrNoPEMData = errors.New("cert: no PEM data found")
+
+// DecodeKey decodes the first private key found in PEM data. PKCS #8, PKCS #1 (RSA)
+// and SEC 1 (EC) keys are supported.
+func DecodeKey(keyPEM []byte) (key crypto.Signer, err error) {
+	for {
+		var block *pem.Block
+		block, keyPEM = pem.Decode(keyPEM)
+		if block == nil {
+			return nil, ErrNoPEMData
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("cert: failed to parse PKCS #8 private key: %w", err)
+			}
+			signer, ok := k.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("cert: unsupported private key type %T", k)
+			}
+			return signer, nil
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				err = fmt.Errorf("cert: failed to parse PKCS #1 private key: %w", err)
+			}
+			return
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				err = fmt.Errorf("cert: failed to parse EC private key: %w", err)
+			}
+			return
+		}
+	}
+}
+
+// EncodeCertificate encodes DER certificate data as a "CERTIFICATE" PEM block.
+func EncodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// DecodeCertificates decodes all of the certificates found in PEM data.
+func DecodeCertificates(certPEM []byte) (certs []*x509.Certificate, err error) {
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cert: failed to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		err = ErrNoPEMData
+	}
+	return
+}
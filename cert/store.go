@@ -1,78 +1,300 @@
 package cert
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
+	"bytes"
+	"crypto/tls"
 	"crypto/x509"
-	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
-	"math/big"
-	"net"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
-	"time"
+	"sync"
+
+	"github.com/a-h/gemini/internal/atomicfile"
 )
 
-// Generate a pair of keys. These keys can be loaded with
-// cert, err = tls.LoadX509KeyPair("cert.pem", "key.pem")
-func Generate(organization, commonName, hosts string, duration time.Duration) (cert, key []byte, err error) {
-	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// Entry is a PEM encoded certificate and private key held in a Store.
+type Entry struct {
+	Certificate []byte
+	Key         []byte
+	// Metadata associated with the certificate, e.g. the scope of a client identity.
+	Metadata map[string]string
+}
+
+// KeyPair parses the entry into a certificate that can be used by TLS servers and clients.
+func (e Entry) KeyPair() (tls.Certificate, error) {
+	return tls.X509KeyPair(e.Certificate, e.Key)
+}
+
+// Leaf parses the first certificate of the entry.
+func (e Entry) Leaf() (*x509.Certificate, error) {
+	certs, err := DecodeCertificates(e.Certificate)
 	if err != nil {
-		err = fmt.Errorf("cert: failed to generate private key: %w", err)
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// Store of certificates and keys, keyed by a domain or identity name.
+type Store interface {
+	// Get an entry. If the entry doesn't exist, ErrNotFound is returned.
+	Get(name string) (Entry, error)
+	// Put an entry, replacing any existing entry with the same name.
+	Put(name string, e Entry) error
+	// List the names of the entries in the store, in order.
+	List() ([]string, error)
+	// Delete an entry. If the entry doesn't exist, ErrNotFound is returned.
+	Delete(name string) error
+}
+
+// ErrNotFound is returned when a Store doesn't contain the requested entry.
+var ErrNotFound = errors.New("cert: not found")
+
+// ErrInvalidName is returned when a name can't be used to store an entry.
+var ErrInvalidName = errors.New("cert: invalid name")
+
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("%w %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// NewMemoryStore creates a Store that holds entries in memory.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]Entry),
+	}
+}
+
+// MemoryStore holds entries in memory.
+type MemoryStore struct {
+	m       sync.RWMutex
+	entries map[string]Entry
+}
+
+// Get an entry.
+func (s *MemoryStore) Get(name string) (e Entry, err error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	e, ok := s.entries[name]
+	if !ok {
+		err = ErrNotFound
 		return
 	}
+	return copyEntry(e), nil
+}
 
-	// ECDSA, ED25519 and RSA subject keys should have the DigitalSignature
-	// KeyUsage bits set in the x509.Certificate template
-	keyUsage := x509.KeyUsageDigitalSignature
+// Put an entry.
+func (s *MemoryStore) Put(name string, e Entry) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.entries[name] = copyEntry(e)
+	return nil
+}
 
-	// Give some flexibility to handle clock adjustments.
-	notBefore := time.Now().Add(time.Hour * -24)
-	notAfter := time.Now().Add(duration)
+// List the names of the entries.
+func (s *MemoryStore) List() (names []string, err error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
 
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+// Delete an entry.
+func (s *MemoryStore) Delete(name string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.entries[name]; !ok {
+		return ErrNotFound
+	}
+	delete(s.entries, name)
+	return nil
+}
+
+func copyEntry(e Entry) (c Entry) {
+	c.Certificate = append([]byte(nil), e.Certificate...)
+	c.Key = append([]byte(nil), e.Key...)
+	if e.Metadata != nil {
+		c.Metadata = make(map[string]string, len(e.Metadata))
+		for k, v := range e.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	return
+}
+
+// NewFileStore creates a Store that keeps entries in dir, creating the directory if required.
+// Each entry is stored in a single file, <name>.pem, that's only readable by the owner. The
+// file contains the certificate, the private key, and a METADATA block if the entry has
+// metadata, so it can be used as both the certificate and key file of other programs.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cert: failed to create store directory: %w", err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// FileStore keeps entries in a directory.
+type FileStore struct {
+	Dir string
+}
+
+const pemExt = ".pem"
+
+// metadataBlockType is the PEM block type used to store the metadata of an entry.
+const metadataBlockType = "METADATA"
+
+func (s *FileStore) path(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, url.PathEscape(name)), nil
+}
+
+// Get an entry.
+func (s *FileStore) Get(name string) (e Entry, err error) {
+	path, err := s.path(name)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(path + pemExt)
 	if err != nil {
-		err = fmt.Errorf("cert: failed to generate serial number: %w", err)
+		if os.IsNotExist(err) {
+			err = ErrNotFound
+		}
 		return
 	}
+	return decodeEntry(name, data)
+}
 
-	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{organization},
-		},
-		NotBefore:             notBefore,
-		NotAfter:              notAfter,
-		KeyUsage:              keyUsage,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		BasicConstraintsValid: true,
-	}
-
-	if hosts != "" {
-		for _, h := range strings.Split("hosts", ",") {
-			if ip := net.ParseIP(h); ip != nil {
-				template.IPAddresses = append(template.IPAddresses, ip)
-			} else {
-				template.DNSNames = append(template.DNSNames, h)
+func decodeEntry(name string, data []byte) (e Entry, err error) {
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			e.Certificate = append(e.Certificate, pem.EncodeToMemory(block)...)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			e.Key = pem.EncodeToMemory(block)
+		case block.Type == metadataBlockType:
+			if err = json.Unmarshal(block.Bytes, &e.Metadata); err != nil {
+				err = fmt.Errorf("cert: failed to read metadata of %q: %w", name, err)
+				return
 			}
 		}
 	}
+	if len(e.Certificate) == 0 || len(e.Key) == 0 {
+		err = fmt.Errorf("cert: %q doesn't contain a certificate and private key", name)
+	}
+	return
+}
+
+func encodeEntry(e Entry) (data []byte, err error) {
+	if block, _ := pem.Decode(e.Certificate); block == nil {
+		return nil, errors.New("cert: the certificate isn't PEM encoded")
+	}
+	if block, _ := pem.Decode(e.Key); block == nil {
+		return nil, errors.New("cert: the key isn't PEM encoded")
+	}
+	var buf bytes.Buffer
+	for _, b := range [][]byte{e.Certificate, e.Key} {
+		buf.Write(b)
+		if !bytes.HasSuffix(b, []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+	}
+	if len(e.Metadata) > 0 {
+		metadata, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("cert: failed to encode metadata: %w", err)
+		}
+		if err = pem.Encode(&buf, &pem.Block{Type: metadataBlockType, Bytes: metadata}); err != nil {
+			return nil, fmt.Errorf("cert: failed to encode metadata: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Put an entry. The certificate, key and metadata are written to a temporary file that's
+// renamed, so that readers never see a partially written entry, or a certificate that
+// doesn't match its key.
+func (s *FileStore) Put(name string, e Entry) (err error) {
+	path, err := s.path(name)
+	if err != nil {
+		return
+	}
+	data, err := encodeEntry(e)
+	if err != nil {
+		return
+	}
+	if err = atomicfile.Write(path+pemExt, data, 0600); err != nil {
+		return fmt.Errorf("cert: failed to write %q: %w", name, err)
+	}
+	return nil
+}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+// List the names of the entries.
+func (s *FileStore) List() (names []string, err error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*"+pemExt))
 	if err != nil {
-		err = fmt.Errorf("cert: failed to create certificate: %w", err)
 		return
 	}
-	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	for _, f := range files {
+		name, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(f), pemExt))
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
 
-	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+// Delete an entry.
+func (s *FileStore) Delete(name string) (err error) {
+	path, err := s.path(name)
 	if err != nil {
-		err = fmt.Errorf("cert: failed to marshal private key: %v", err)
 		return
 	}
-	key = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+	if err = os.Remove(path + pemExt); os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+	return
+}
+
+// LoadKeyPair loads the named certificate from the store, for use by TLS servers and clients.
+func LoadKeyPair(s Store, name string) (tls.Certificate, error) {
+	e, err := s.Get(name)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return e.KeyPair()
+}
 
+// NewEntry encodes a TLS certificate and its private key as a store Entry.
+func NewEntry(keyPair tls.Certificate) (e Entry, err error) {
+	if len(keyPair.Certificate) == 0 {
+		err = errors.New("cert: key pair has no certificate")
+		return
+	}
+	for _, der := range keyPair.Certificate {
+		e.Certificate = append(e.Certificate, EncodeCertificate(der)...)
+	}
+	e.Key, err = EncodeKey(keyPair.PrivateKey)
 	return
 }
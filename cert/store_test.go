@@ -0,0 +1,129 @@
+package cert
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_cert_store")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fs, err := NewFileStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fs,
+	}
+	certPEM, keyPEM, err := GenerateServer(Options{CommonName: "example.com", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	for name, s := range stores {
+		s := s
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Get("example.com"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound for missing entries, got %v", err)
+			}
+			if err := s.Put("..", Entry{}); !errors.Is(err, ErrInvalidName) {
+				t.Errorf("expected ErrInvalidName, got %v", err)
+			}
+
+			expected := Entry{Certificate: certPEM, Key: keyPEM}
+			if err := s.Put("example.com", expected); err != nil {
+				t.Fatalf("failed to put entry: %v", err)
+			}
+			withMetadata := Entry{Certificate: certPEM, Key: keyPEM, Metadata: map[string]string{"scope": "gemini://example.com/"}}
+			if err := s.Put("user/name", withMetadata); err != nil {
+				t.Fatalf("failed to put entry: %v", err)
+			}
+
+			actual, err := s.Get("example.com")
+			if err != nil {
+				t.Fatalf("failed to get entry: %v", err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+			if _, err = LoadKeyPair(s, "example.com"); err != nil {
+				t.Errorf("failed to load key pair: %v", err)
+			}
+			actual, err = s.Get("user/name")
+			if err != nil {
+				t.Fatalf("failed to get entry: %v", err)
+			}
+			if !reflect.DeepEqual(withMetadata, actual) {
+				t.Errorf("expected %v, got %v", withMetadata, actual)
+			}
+
+			names, err := s.List()
+			if err != nil {
+				t.Fatalf("failed to list entries: %v", err)
+			}
+			if !reflect.DeepEqual(names, []string{"example.com", "user/name"}) {
+				t.Errorf("unexpected names: %v", names)
+			}
+
+			if err = s.Delete("example.com"); err != nil {
+				t.Fatalf("failed to delete entry: %v", err)
+			}
+			if err = s.Delete("example.com"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound when deleting a missing entry, got %v", err)
+			}
+			names, _ = s.List()
+			if !reflect.DeepEqual(names, []string{"user/name"}) {
+				t.Errorf("unexpected names after delete: %v", names)
+			}
+		})
+	}
+}
+
+func TestFileStorePermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_cert_store")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+	certPEM, keyPEM, err := GenerateServer(Options{CommonName: "example.com", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	if err = s.Put("example.com", Entry{Certificate: certPEM, Key: keyPEM}); err != nil {
+		t.Fatalf("failed to put entry: %v", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	perms := map[string]os.FileMode{}
+	for _, f := range files {
+		perms[f.Name()] = f.Mode().Perm()
+	}
+	expected := map[string]os.FileMode{
+		"example.com.pem": 0600,
+	}
+	if !reflect.DeepEqual(perms, expected) {
+		t.Errorf("expected files %v, got %v", expected, perms)
+	}
+	path := filepath.Join(dir, "example.com.pem")
+	if _, err = tls.LoadX509KeyPair(path, path); err != nil {
+		t.Errorf("expected the file to contain the certificate and key: %v", err)
+	}
+	if err = s.Put("invalid", Entry{Certificate: []byte("cert"), Key: []byte("key")}); err == nil {
+		t.Errorf("expected an error storing an entry that isn't PEM encoded")
+	}
+}
@@ -3,9 +3,7 @@ package gemini
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"crypto/tls"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -13,7 +11,11 @@ import (
 	"net"
 	"net/url"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	certpkg "github.com/a-h/gemini/cert"
 )
 
 // Response from the Gemini server.
@@ -124,7 +126,7 @@ func isValidMeta(m string) bool {
 // NewClient creates a new gemini client.
 func NewClient() *Client {
 	return &Client{
-		prefixToCertificate:            make(map[string]tls.Certificate),
+		Identities:                     NewIdentityStore(),
 		domainToAllowedCertificateHash: make(map[string]map[string]interface{}),
 		WriteTimeout:                   time.Second * 5,
 		ReadTimeout:                    time.Second * 5,
@@ -133,21 +135,33 @@ func NewClient() *Client {
 
 // Client for Gemini requests.
 type Client struct {
-	// prefixToCertificate maps URL prefixes to certificates.
-	// Load a keypair from disk with tls.LoadX509KeyPair("client.pem", "client.key")
-	// If a certificate is not required, use &Client{}.
-	prefixToCertificate map[string]tls.Certificate
+	// Identities are the client certificates presented to servers. The identity with the
+	// longest scope that prefixes the requested URL is used.
+	Identities *IdentityStore
 	// domainToAllowedCertificateHash is used to validate the remote server.
 	domainToAllowedCertificateHash map[string]map[string]interface{}
 	// Insecure mode does not check the hash of remote certificates.
 	Insecure     bool
 	WriteTimeout time.Duration
-	ReadTimeout  time.Duration
+	// ReadTimeout is the maximum time to wait for data from the server. It applies to
+	// each read, so large responses can be streamed as long as data keeps arriving.
+	ReadTimeout time.Duration
+	// MaxBodySize is the maximum number of bytes of response body that will be read.
+	// Reading beyond the limit returns ErrBodyTooLarge. Zero means no limit.
+	MaxBodySize int64
+	// Retry policy for temporary failures (4x). If nil, requests are not retried.
+	Retry *RetryPolicy
 }
 
 // AddClientCertificate adds a certificate to use when the URL prefix is encountered.
+// Load a keypair from disk with tls.LoadX509KeyPair("client.pem", "client.key")
+// The certificate is held in memory only, and is named after its prefix.
 func (client *Client) AddClientCertificate(prefix string, cert tls.Certificate) {
-	client.prefixToCertificate[prefix] = cert
+	client.Identities.set(Identity{
+		Name:        prefix,
+		Scope:       prefix,
+		Certificate: cert,
+	})
 }
 
 // AddServerCertificate allows the client to connect to a domain based on its hash.
@@ -170,18 +184,21 @@ func (client *Client) Request(ctx context.Context, u string) (resp *Response, ce
 
 // GetCertificate returns a certificate to use for the given URL, if one exists.
 func (client *Client) GetCertificate(u *url.URL) (cert tls.Certificate, ok bool) {
-	for k, v := range client.prefixToCertificate {
-		if strings.HasPrefix(u.String(), k) {
-			cert = v
-			ok = true
-			return
-		}
+	if client.Identities == nil {
+		return
 	}
-	return
+	id, ok := client.Identities.Match(u)
+	return id.Certificate, ok
 }
 
 // RequestNoTLS carries out a request without TLS enabled.
 func (client *Client) RequestNoTLS(ctx context.Context, u *url.URL) (resp *Response, err error) {
+	return client.Retry.retry(ctx, func() (*Response, error) {
+		return client.requestNoTLS(ctx, u)
+	})
+}
+
+func (client *Client) requestNoTLS(ctx context.Context, u *url.URL) (resp *Response, err error) {
 	dialer := net.Dialer{
 		Timeout: client.ReadTimeout,
 	}
@@ -200,6 +217,16 @@ func (client *Client) RequestNoTLS(ctx context.Context, u *url.URL) (resp *Respo
 // RequestURL requests a response from a parsed URL.
 // ok returns true if a matching server certificate is found (i.e. the server is OK).
 func (client *Client) RequestURL(ctx context.Context, u *url.URL) (resp *Response, certificates []string, authenticated, ok bool, err error) {
+	resp, err = client.Retry.retry(ctx, func() (*Response, error) {
+		var r *Response
+		var err error
+		r, certificates, authenticated, ok, err = client.requestURL(ctx, u)
+		return r, err
+	})
+	return
+}
+
+func (client *Client) requestURL(ctx context.Context, u *url.URL) (resp *Response, certificates []string, authenticated, ok bool, err error) {
 	tlsDialer := tls.Dialer{
 		NetDialer: &net.Dialer{
 			Timeout: client.ReadTimeout,
@@ -224,22 +251,24 @@ func (client *Client) RequestURL(ctx context.Context, u *url.URL) (resp *Respons
 	allowedHashesForDomain := client.domainToAllowedCertificateHash[strings.ToLower(u.Host)]
 	ok = false
 	for _, cert := range conn.ConnectionState().PeerCertificates {
-		certHash := sha256.Sum256(cert.Raw)
-		hash := base64.StdEncoding.EncodeToString(certHash[:])
+		hash := certpkg.Fingerprint(cert)
 		certificates = append(certificates, hash)
 		if _, ok = allowedHashesForDomain[hash]; ok {
 			break
 		}
 		if time.Now().Before(cert.NotBefore) {
-			err = fmt.Errorf("gemini: expired certificate")
+			conn.Close()
+			err = fmt.Errorf("gemini: certificate not yet valid")
 			return
 		}
 		if time.Now().After(cert.NotAfter) {
-			err = fmt.Errorf("gemini: certificate not yet valid")
+			conn.Close()
+			err = fmt.Errorf("gemini: expired certificate")
 			return
 		}
 	}
 	if !ok && !client.Insecure {
+		conn.Close()
 		return
 	}
 	authenticated = conn.ConnectionState().NegotiatedProtocolIsMutual
@@ -247,27 +276,118 @@ func (client *Client) RequestURL(ctx context.Context, u *url.URL) (resp *Respons
 	return
 }
 
-type readerCtx struct {
-	ctx context.Context
-	r   io.ReadCloser
+// ErrBodyTooLarge is returned when reading a response body that is larger than the Client's MaxBodySize.
+// The body is truncated at MaxBodySize.
+var ErrBodyTooLarge = errors.New("gemini: response body exceeded maximum size")
+
+// ErrBodyTruncated is returned when a TLS connection is cut part way through a record, or
+// reset, so the response body is incomplete. Gemini responses don't include their length,
+// and crypto/tls treats a connection that's closed between records in the same way as a
+// close_notify alert, so bodies that are cut short between records, or sent without TLS,
+// can't be detected as truncated.
+var ErrBodyTruncated = errors.New("gemini: connection closed before the end of the response body")
+
+// ErrReadTimeout is returned when the server doesn't send any data within the Client's ReadTimeout.
+var ErrReadTimeout = errors.New("gemini: read timeout")
+
+// bodyReader reads a response from the connection, applying an idle timeout to each
+// read, limiting the size of the body, and closing the connection when the context
+// is cancelled so that blocked reads return.
+type bodyReader struct {
+	ctx         context.Context
+	conn        net.Conn
+	idleTimeout time.Duration
+	// remaining bytes that can be read, or -1 if there is no limit.
+	remaining int64
+	// done stops watching the context, once the body has been read or closed.
+	done      chan struct{}
+	doneOnce  sync.Once
+	closeOnce sync.Once
 }
 
-func (r *readerCtx) Read(p []byte) (n int, err error) {
-	if err := r.ctx.Err(); err != nil {
-		return 0, err
+func newBodyReader(ctx context.Context, conn net.Conn, idleTimeout time.Duration) *bodyReader {
+	r := &bodyReader{
+		ctx:         ctx,
+		conn:        conn,
+		idleTimeout: idleTimeout,
+		remaining:   -1,
+		done:        make(chan struct{}),
 	}
-	return r.r.Read(p)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-r.done:
+		}
+	}()
+	return r
 }
 
-func (r *readerCtx) Close() (err error) {
-	return r.r.Close()
+// limit the number of bytes that can be read from this point onwards.
+func (r *bodyReader) limit(n int64) {
+	if n > 0 {
+		r.remaining = n
+	}
 }
 
-func newReaderContext(ctx context.Context, r io.ReadCloser) io.ReadCloser {
-	return &readerCtx{
-		ctx: ctx,
-		r:   r,
+func (r *bodyReader) Read(p []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		return
+	}
+	if r.remaining == 0 {
+		// Check whether there's any more data, to tell the difference between a body that's
+		// exactly MaxBodySize, and one that's larger.
+		p = make([]byte, 1)
+	} else if r.remaining > 0 && int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
 	}
+	if r.idleTimeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.idleTimeout))
+	}
+	n, err = r.conn.Read(p)
+	if r.remaining == 0 && n > 0 {
+		r.stop()
+		return 0, ErrBodyTooLarge
+	}
+	if r.remaining > 0 {
+		r.remaining -= int64(n)
+	}
+	if err == nil {
+		return
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() && r.ctx.Err() == nil {
+		// Reads after a timeout are still bounded by the idle timeout, so keep watching
+		// the context in case the caller retries.
+		return n, ErrReadTimeout
+	}
+	r.stop()
+	if err == io.EOF {
+		return
+	}
+	if ctxErr := r.ctx.Err(); ctxErr != nil {
+		return n, ctxErr
+	}
+	if _, isTLS := r.conn.(*tls.Conn); isTLS && (errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)) {
+		// crypto/tls returns io.ErrUnexpectedEOF when the connection closes part way
+		// through a record, so the server can't have sent a close_notify alert.
+		return n, ErrBodyTruncated
+	}
+	return
+}
+
+// stop watching the context, so that the goroutine started by newBodyReader exits.
+func (r *bodyReader) stop() {
+	r.doneOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+func (r *bodyReader) Close() (err error) {
+	r.closeOnce.Do(func() {
+		r.stop()
+		err = r.conn.Close()
+	})
+	return
 }
 
 // RequestConn uses a given connection to make the request. This allows for insecure requests to be made.
@@ -279,11 +399,26 @@ func (client *Client) RequestConn(ctx context.Context, conn net.Conn, u *url.URL
 		err = fmt.Errorf("gemini: error writing request: %w", err)
 		return
 	}
-	conn.SetReadDeadline(time.Now().Add(client.ReadTimeout))
-	resp, err = NewResponse(newReaderContext(ctx, conn))
+	body := newBodyReader(ctx, conn, client.ReadTimeout)
+	resp, err = NewResponse(body)
+	if err != nil {
+		body.Close()
+		return
+	}
+	body.limit(client.MaxBodySize)
 	return
 }
 
+// WithInput returns a copy of u with the query set to the input, as required to respond
+// to an input (10) or sensitive input (11) prompt. The input is percent-encoded, with
+// spaces encoded as %20 rather than +.
+func WithInput(u *url.URL, input string) *url.URL {
+	uu := *u
+	uu.RawQuery = strings.ReplaceAll(url.QueryEscape(input), "+", "%20")
+	uu.ForceQuery = false
+	return &uu
+}
+
 // Record a Gemini handler request in memory and return the response.
 func Record(r *Request, handler Handler) (resp *Response, err error) {
 	buf := new(bytes.Buffer)
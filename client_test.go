@@ -0,0 +1,246 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/a-h/gemini/cert"
+)
+
+func TestWithInput(t *testing.T) {
+	var tests = []struct {
+		name     string
+		url      string
+		input    string
+		expected string
+	}{
+		{
+			name:     "input is added as the query",
+			url:      "gemini://example.com/search",
+			input:    "gemini",
+			expected: "gemini://example.com/search?gemini",
+		},
+		{
+			name:     "spaces are encoded as %20",
+			url:      "gemini://example.com/search",
+			input:    "hello world",
+			expected: "gemini://example.com/search?hello%20world",
+		},
+		{
+			name:     "reserved characters are escaped",
+			url:      "gemini://example.com/search",
+			input:    "a+b=c&d?",
+			expected: "gemini://example.com/search?a%2Bb%3Dc%26d%3F",
+		},
+		{
+			name:     "existing queries are replaced",
+			url:      "gemini://example.com/search?old",
+			input:    "new",
+			expected: "gemini://example.com/search?new",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("failed to parse URL %q: %v", tt.url, err)
+			}
+			actual := WithInput(u, tt.input)
+			if actual.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual.String())
+			}
+			if u.String() != tt.url {
+				t.Errorf("expected the input URL to be unmodified, got %q", u.String())
+			}
+			input, err := url.QueryUnescape(actual.RawQuery)
+			if err != nil {
+				t.Fatalf("failed to unescape query: %v", err)
+			}
+			if input != tt.input {
+				t.Errorf("expected input to round trip to %q, got %q", tt.input, input)
+			}
+		})
+	}
+}
+
+func TestClientResponseBody(t *testing.T) {
+	var tests = []struct {
+		name         string
+		response     string
+		maxBodySize  int64
+		keepOpen     bool
+		cancel       bool
+		expectedBody string
+		expectedErr  error
+	}{
+		{
+			name:         "bodies are read until the connection is closed",
+			response:     "20 text/plain\r\nHello, World!",
+			expectedBody: "Hello, World!",
+		},
+		{
+			name:         "bodies within the maximum size are read",
+			response:     "20 text/plain\r\nHello, World!",
+			maxBodySize:  13,
+			expectedBody: "Hello, World!",
+		},
+		{
+			name:         "bodies larger than the maximum size are truncated",
+			response:     "20 text/plain\r\nHello, World!",
+			maxBodySize:  5,
+			expectedBody: "Hello",
+			expectedErr:  ErrBodyTooLarge,
+		},
+		{
+			name:         "servers that stop sending data time out",
+			response:     "20 text/plain\r\nHello",
+			keepOpen:     true,
+			expectedBody: "Hello",
+			expectedErr:  ErrReadTimeout,
+		},
+		{
+			name:         "cancelling the context interrupts blocked reads",
+			response:     "20 text/plain\r\nHello",
+			keepOpen:     true,
+			cancel:       true,
+			expectedBody: "Hello",
+			expectedErr:  context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer serverConn.Close()
+			go func() {
+				request, _, _ := readUntilCrLf(serverConn, 1026)
+				if string(request) != "gemini://example.com\r" {
+					t.Errorf("unexpected request: %q", string(request))
+				}
+				serverConn.Write([]byte(tt.response))
+				if !tt.keepOpen {
+					serverConn.Close()
+				}
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			client := NewClient()
+			client.MaxBodySize = tt.maxBodySize
+			client.ReadTimeout = time.Millisecond * 100
+			if tt.cancel {
+				client.ReadTimeout = time.Minute
+				time.AfterFunc(time.Millisecond*100, cancel)
+			}
+			u, _ := url.Parse("gemini://example.com")
+			resp, err := client.RequestConn(ctx, clientConn, u)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			start := time.Now()
+			body, err := ioutil.ReadAll(resp.Body)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if string(body) != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, string(body))
+			}
+			if time.Since(start) > time.Second*5 {
+				t.Errorf("expected the read to return promptly, took %v", time.Since(start))
+			}
+			if !errors.Is(tt.expectedErr, ErrReadTimeout) {
+				select {
+				case <-resp.Body.(*bodyReader).done:
+				default:
+					t.Errorf("expected the context to stop being watched once the body has been read")
+				}
+			}
+		})
+	}
+}
+
+func TestClientTruncatedTLSBody(t *testing.T) {
+	certPEM, keyPEM, err := cert.GenerateServer(cert.Options{CommonName: "example.com", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	kp, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	var tests = []struct {
+		name         string
+		closeNotify  bool
+		cutRecord    bool
+		expectedBody string
+		expectedErr  error
+	}{
+		{
+			name:         "bodies ended with a close_notify alert are complete",
+			closeNotify:  true,
+			expectedBody: "Hello",
+		},
+		{
+			name:         "connections cut part way through a record are truncated",
+			cutRecord:    true,
+			expectedBody: "Hello",
+			expectedErr:  ErrBodyTruncated,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer ln.Close()
+			go func() {
+				raw, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer raw.Close()
+				conn := tls.Server(raw, &tls.Config{Certificates: []tls.Certificate{kp}})
+				readUntilCrLf(conn, 1026)
+				conn.Write([]byte("20 text/plain\r\nHello"))
+				if tt.closeNotify {
+					conn.Close()
+				}
+				if tt.cutRecord {
+					// The header of an application data record of 100 bytes, followed by 10 bytes.
+					raw.Write(append([]byte{0x17, 0x03, 0x03, 0x00, 0x64}, make([]byte, 10)...))
+				}
+			}()
+
+			conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			client := NewClient()
+			client.ReadTimeout = time.Second * 5
+			u, _ := url.Parse("gemini://example.com")
+			resp, err := client.RequestConn(context.Background(), conn, u)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if string(body) != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, string(body))
+			}
+		})
+	}
+}
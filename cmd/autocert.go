@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/a-h/gemini/cert"
+	"github.com/a-h/gemini/internal/atomicfile"
+	"github.com/a-h/gemini/log"
+)
+
+var (
+	// autoCertDuration is the validity period of generated certificates. Gemini clients
+	// use trust-on-first-use, so certificates should change as rarely as possible.
+	autoCertDuration = time.Hour * 24 * 365 * 20
+	// autoCertExpiryWarning is how long before expiry a warning is logged.
+	autoCertExpiryWarning = time.Hour * 24 * 30
+)
+
+// certificateStore is the part of cert.Store that's used to keep generated certificates.
+type certificateStore interface {
+	Get(name string) (cert.Entry, error)
+	Put(name string, e cert.Entry) error
+}
+
+// keyPairFiles keeps the certificate of a domain in the cert and key files configured for it.
+type keyPairFiles struct {
+	certFile string
+	keyFile  string
+}
+
+func (k keyPairFiles) Get(name string) (e cert.Entry, err error) {
+	if e.Certificate, err = ioutil.ReadFile(k.certFile); err != nil {
+		if os.IsNotExist(err) {
+			err = cert.ErrNotFound
+		}
+		return
+	}
+	if e.Key, err = ioutil.ReadFile(k.keyFile); err != nil {
+		if os.IsNotExist(err) {
+			err = cert.ErrNotFound
+		}
+	}
+	return
+}
+
+// Put writes the key, then the certificate. Each file is replaced atomically, but if the
+// process stops between them the files won't match, and loading them fails.
+func (k keyPairFiles) Put(name string, e cert.Entry) (err error) {
+	for _, dir := range []string{filepath.Dir(k.certFile), filepath.Dir(k.keyFile)} {
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create certificate directory: %w", err)
+		}
+	}
+	if err = atomicfile.Write(k.keyFile, e.Key, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	if err = atomicfile.Write(k.certFile, e.Certificate, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// loadOrGenerateCertificate loads the certificate for the domain from the store. If the
+// certificate doesn't exist, or has expired, a new self-signed certificate is generated
+// and written to the store.
+func loadOrGenerateCertificate(store certificateStore, domain string) (keyPair tls.Certificate, generated bool, err error) {
+	e, err := store.Get(domain)
+	if err != nil && !errors.Is(err, cert.ErrNotFound) {
+		err = fmt.Errorf("failed to load certificate: %w", err)
+		return
+	}
+	if err == nil {
+		leaf, parseErr := e.Leaf()
+		if parseErr != nil {
+			err = fmt.Errorf("failed to parse certificate: %w", parseErr)
+			return
+		}
+		untilExpiry := time.Until(leaf.NotAfter)
+		if untilExpiry > 0 {
+			if untilExpiry < autoCertExpiryWarning {
+				log.Warn("autoCert: certificate expires soon, delete it to generate a new one",
+					log.String("domain", domain),
+					log.String("notAfter", leaf.NotAfter.Format(time.RFC3339)),
+					log.String("fingerprint", cert.Fingerprint(leaf)))
+			}
+			keyPair, err = e.KeyPair()
+			return
+		}
+		log.Warn("autoCert: certificate expired, generating a new one",
+			log.String("domain", domain),
+			log.String("notAfter", leaf.NotAfter.Format(time.RFC3339)))
+	}
+
+	e.Certificate, e.Key, err = cert.GenerateServer(cert.Options{
+		CommonName: domain,
+		Hosts:      []string{domain},
+		Duration:   autoCertDuration,
+	})
+	if err != nil {
+		return
+	}
+	if err = store.Put(domain, e); err != nil {
+		err = fmt.Errorf("failed to store certificate: %w", err)
+		return
+	}
+	if keyPair, err = e.KeyPair(); err != nil {
+		return
+	}
+	generated = true
+	leaf, _ := e.Leaf()
+	log.Info("autoCert: generated certificate",
+		log.String("domain", domain),
+		log.String("notAfter", leaf.NotAfter.Format(time.RFC3339)),
+		log.String("fingerprint", cert.Fingerprint(leaf)))
+	return
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/a-h/gemini/cert"
+)
+
+func TestLoadOrGenerateCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_autocert")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := cert.NewFileStore(filepath.Join(dir, "state"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	first, generated, err := loadOrGenerateCertificate(store, "example.com")
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	if !generated {
+		t.Errorf("expected a certificate to be generated on first start")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "state", "example.com.pem")); err != nil {
+		t.Errorf("expected certificate file to be written: %v", err)
+	}
+
+	second, generated, err := loadOrGenerateCertificate(store, "example.com")
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	if generated {
+		t.Errorf("expected the certificate to be reused on subsequent starts")
+	}
+	if !reflect.DeepEqual(first.Certificate, second.Certificate) {
+		t.Errorf("expected the same certificate to be loaded")
+	}
+}
+
+func TestLoadOrGenerateCertificateKeyPairFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_autocert")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := keyPairFiles{
+		certFile: filepath.Join(dir, "certs", "server.crt"),
+		keyFile:  filepath.Join(dir, "certs", "server.key"),
+	}
+	first, generated, err := loadOrGenerateCertificate(files, "example.com")
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	if !generated {
+		t.Errorf("expected a certificate to be generated on first start")
+	}
+	if _, err = tls.LoadX509KeyPair(files.certFile, files.keyFile); err != nil {
+		t.Errorf("expected the configured cert and key files to be written: %v", err)
+	}
+	fi, err := os.Stat(files.keyFile)
+	if err != nil {
+		t.Fatalf("failed to stat key file: %v", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected key file mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	second, generated, err := loadOrGenerateCertificate(files, "example.com")
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	if generated {
+		t.Errorf("expected the certificate to be reused on subsequent starts")
+	}
+	if !reflect.DeepEqual(first.Certificate, second.Certificate) {
+		t.Errorf("expected the same certificate to be loaded")
+	}
+}
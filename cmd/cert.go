@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/a-h/gemini/cert"
+	"github.com/a-h/gemini/internal/atomicfile"
+)
+
+func certCommand(args []string) {
+	if len(args) < 1 {
+		certUsage()
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "generate":
+		certGenerate(args[1:])
+		return
+	case "inspect":
+		certInspect(args[1:])
+		return
+	case "check":
+		certCheck(args[1:])
+		return
+	}
+	certUsage()
+	os.Exit(1)
+}
+
+func certUsage() {
+	fmt.Println(`usage: gemini cert <command> [parameters]
+To see help text, you can run:
+
+  gemini cert generate --help
+  gemini cert inspect --help
+  gemini cert check --help
+
+examples:
+
+  gemini cert generate --domain=example.com --days=3650 --out=server
+  gemini cert generate --client --domain=alice --out=alice
+  gemini cert inspect server.crt
+  gemini cert inspect gemini://example.com
+  gemini cert check --days=30 gemini://example.com gemini://example.org`)
+}
+
+func certGenerate(args []string) {
+	cmd := flag.NewFlagSet("generate", flag.ExitOnError)
+	domainFlag := cmd.String("domain", "localhost", "The domain of the server certificate, or the name of the client identity. Additional hosts can be added, separated by commas.")
+	organizationFlag := cmd.String("organization", "", "The organization name to include in the certificate subject.")
+	daysFlag := cmd.Int("days", 3650, "Number of days that the certificate is valid for.")
+	keyTypeFlag := cmd.String("keyType", string(cert.DefaultKeyType), fmt.Sprintf("Type of key to generate, one of: %v", cert.KeyTypes))
+	clientFlag := cmd.Bool("client", false, "Generate a client certificate (identity) instead of a server certificate.")
+	caCertFileFlag := cmd.String("caCertFile", "", "Path to a CA certificate to sign the certificate with (must also set caKeyFile if this is used). If not set, the certificate is self-signed.")
+	caKeyFileFlag := cmd.String("caKeyFile", "", "Path to a CA key to sign the certificate with (must also set caCertFile if this is used).")
+	outFlag := cmd.String("out", "", "Output path prefix, the certificate is written to <out>.crt and the key to <out>.key. Defaults to the first domain.")
+	forceFlag := cmd.Bool("force", false, "Overwrite existing certificate and key files.")
+	helpFlag := cmd.Bool("help", false, "Print help and exit.")
+	err := cmd.Parse(args)
+	if err != nil || *helpFlag {
+		cmd.PrintDefaults()
+		return
+	}
+
+	keyType, err := cert.ParseKeyType(*keyTypeFlag)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	hosts := cert.SplitHosts(*domainFlag)
+	if len(hosts) == 0 {
+		fmt.Println("error: domain flag is required")
+		os.Exit(1)
+	}
+	opts := cert.Options{
+		Organization: *organizationFlag,
+		CommonName:   hosts[0],
+		Duration:     time.Hour * 24 * time.Duration(*daysFlag),
+		KeyType:      keyType,
+	}
+	if !*clientFlag {
+		opts.Hosts = hosts
+	}
+	var ca *cert.CA
+	if *caCertFileFlag != "" || *caKeyFileFlag != "" {
+		ca, err = loadCA(*caCertFileFlag, *caKeyFileFlag)
+		if err != nil {
+			fmt.Printf("error: failed to load CA: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var certPEM, keyPEM []byte
+	switch {
+	case ca != nil && *clientFlag:
+		certPEM, keyPEM, err = ca.SignClient(opts)
+	case ca != nil:
+		certPEM, keyPEM, err = ca.SignServer(opts)
+	case *clientFlag:
+		certPEM, keyPEM, err = cert.GenerateClient(opts)
+	default:
+		certPEM, keyPEM, err = cert.GenerateServer(opts)
+	}
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := *outFlag
+	if out == "" {
+		out = hosts[0]
+	}
+	if err = writeKeyPair(out, certPEM, keyPEM, *forceFlag); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			fmt.Printf("error: %v, set --force to overwrite it\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s.crt and %s.key\n", out, out)
+	certs, err := cert.DecodeCertificates(certPEM)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	printCertificate(certs[0])
+}
+
+func loadCA(certFile, keyFile string) (ca *cert.CA, err error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return
+	}
+	return cert.LoadCA(certPEM, keyPEM)
+}
+
+func certInspect(args []string) {
+	cmd := flag.NewFlagSet("inspect", flag.ExitOnError)
+	timeoutFlag := cmd.Duration("timeout", time.Second*5, "Connection timeout when inspecting the certificate of a gemini:// URL.")
+	helpFlag := cmd.Bool("help", false, "Print help and exit.")
+	err := cmd.Parse(args)
+	if err != nil || *helpFlag || cmd.NArg() == 0 {
+		fmt.Println("usage: gemini cert inspect [flags] <file|gemini://host>")
+		cmd.PrintDefaults()
+		return
+	}
+	var failed bool
+	for i, target := range cmd.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		certs, err := loadCertificates(target, *timeoutFlag)
+		if err != nil {
+			fmt.Printf("error: %s: %v\n", target, err)
+			failed = true
+			continue
+		}
+		for j, c := range certs {
+			if j > 0 {
+				fmt.Println()
+			}
+			printCertificate(c)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func certCheck(args []string) {
+	cmd := flag.NewFlagSet("check", flag.ExitOnError)
+	daysFlag := cmd.Int("days", 30, "Fail if any certificate expires within this number of days.")
+	timeoutFlag := cmd.Duration("timeout", time.Second*5, "Connection timeout.")
+	helpFlag := cmd.Bool("help", false, "Print help and exit.")
+	err := cmd.Parse(args)
+	if err != nil || *helpFlag || cmd.NArg() == 0 {
+		fmt.Println("usage: gemini cert check [flags] <gemini://host>...")
+		cmd.PrintDefaults()
+		return
+	}
+	now := time.Now()
+	limit := now.Add(time.Hour * 24 * time.Duration(*daysFlag))
+	var failed bool
+	for _, target := range cmd.Args() {
+		certs, err := getServerCertificates(target, *timeoutFlag)
+		if err != nil {
+			fmt.Printf("ERROR    %s: %v\n", target, err)
+			failed = true
+			continue
+		}
+		if len(certs) == 0 {
+			fmt.Printf("ERROR    %s: no certificate presented\n", target)
+			failed = true
+			continue
+		}
+		leaf := certs[0]
+		days := int(leaf.NotAfter.Sub(now).Hours() / 24)
+		status := "OK"
+		switch {
+		case now.After(leaf.NotAfter):
+			status = "EXPIRED"
+			failed = true
+		case limit.After(leaf.NotAfter):
+			status = "EXPIRING"
+			failed = true
+		}
+		fmt.Printf("%-8s %s: expires %s (%d days) %s\n", status, target, leaf.NotAfter.UTC().Format(time.RFC3339), days, cert.Fingerprint(leaf))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// loadCertificates from a PEM file, or from the server at a gemini:// URL.
+func loadCertificates(target string, timeout time.Duration) (certs []*x509.Certificate, err error) {
+	if strings.HasPrefix(target, "gemini://") {
+		return getServerCertificates(target, timeout)
+	}
+	certPEM, err := ioutil.ReadFile(target)
+	if err != nil {
+		return
+	}
+	return cert.DecodeCertificates(certPEM)
+}
+
+// getServerCertificates returns the certificates presented by the server at the given gemini:// URL.
+func getServerCertificates(target string, timeout time.Duration) (certs []*x509.Certificate, err error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	port := u.Port()
+	if port == "" {
+		port = "1965"
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(u.Hostname(), port), &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates, nil
+}
+
+func printCertificate(c *x509.Certificate) {
+	fmt.Printf("Subject:      %v\n", c.Subject)
+	fmt.Printf("Issuer:       %v\n", c.Issuer)
+	var sans []string
+	sans = append(sans, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	fmt.Printf("SANs:         %v\n", strings.Join(sans, ", "))
+	fmt.Printf("Not before:   %v\n", c.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Printf("Not after:    %v\n", c.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Printf("CA:           %v\n", c.IsCA)
+	fmt.Printf("Fingerprint:  %v\n", cert.Fingerprint(c))
+}
+
+// writeKeyPair writes the certificate to <out>.crt and the key to <out>.key. Unless force
+// is set, an error that wraps os.ErrExist is returned if either file exists, and neither
+// file is changed.
+func writeKeyPair(out string, certPEM, keyPEM []byte, force bool) (err error) {
+	if force {
+		if err = atomicfile.Write(out+".key", keyPEM, 0600); err != nil {
+			return fmt.Errorf("failed to write key: %w", err)
+		}
+		if err = atomicfile.Write(out+".crt", certPEM, 0644); err != nil {
+			return fmt.Errorf("failed to write certificate: %w", err)
+		}
+		return nil
+	}
+	if err = createFile(out+".key", keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	if err = createFile(out+".crt", certPEM, 0644); err != nil {
+		os.Remove(out + ".key")
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// createFile writes data to a new file, returning an error that wraps os.ErrExist if the
+// file already exists.
+func createFile(name string, data []byte, perm os.FileMode) (err error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(name)
+		return
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(name)
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteKeyPair(t *testing.T) {
+	var tests = []struct {
+		name          string
+		existing      map[string]os.FileMode
+		force         bool
+		expectExists  bool
+		expectedFiles map[string]string
+	}{
+		{
+			name:          "new files are written",
+			expectedFiles: map[string]string{"server.crt": "cert", "server.key": "key"},
+		},
+		{
+			name:          "an existing key isn't overwritten",
+			existing:      map[string]os.FileMode{"server.key": 0600},
+			expectExists:  true,
+			expectedFiles: map[string]string{"server.key": "existing"},
+		},
+		{
+			name:          "an existing certificate isn't overwritten, and the key isn't written",
+			existing:      map[string]os.FileMode{"server.crt": 0644},
+			expectExists:  true,
+			expectedFiles: map[string]string{"server.crt": "existing"},
+		},
+		{
+			name:          "existing files are overwritten with force",
+			existing:      map[string]os.FileMode{"server.crt": 0644, "server.key": 0644},
+			force:         true,
+			expectedFiles: map[string]string{"server.crt": "cert", "server.key": "key"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gemini_cert")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			for name, perm := range tt.existing {
+				if err = ioutil.WriteFile(filepath.Join(dir, name), []byte("existing"), perm); err != nil {
+					t.Fatalf("failed to write existing file: %v", err)
+				}
+			}
+			err = writeKeyPair(filepath.Join(dir, "server"), []byte("cert"), []byte("key"), tt.force)
+			if exists := errors.Is(err, os.ErrExist); exists != tt.expectExists {
+				t.Fatalf("expected exists error %v, got %v", tt.expectExists, err)
+			}
+			if !tt.expectExists && err != nil {
+				t.Fatalf("failed to write key pair: %v", err)
+			}
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("failed to read dir: %v", err)
+			}
+			if len(files) != len(tt.expectedFiles) {
+				t.Errorf("expected %d files, got %d", len(tt.expectedFiles), len(files))
+			}
+			for name, expected := range tt.expectedFiles {
+				actual, err := ioutil.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Errorf("failed to read %s: %v", name, err)
+					continue
+				}
+				if string(actual) != expected {
+					t.Errorf("expected %s to contain %q, got %q", name, expected, string(actual))
+				}
+			}
+			if tt.expectExists {
+				return
+			}
+			stat, err := os.Stat(filepath.Join(dir, "server.key"))
+			if err != nil {
+				t.Fatalf("failed to stat key: %v", err)
+			}
+			if perm := stat.Mode().Perm(); perm != 0600 {
+				t.Errorf("expected key permissions 0600, got %o", perm)
+			}
+		})
+	}
+}
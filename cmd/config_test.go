@@ -6,6 +6,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/a-h/gemini"
 )
 
 var defaultServerConfig = newServerConfig()
@@ -59,6 +61,110 @@ keyFilePath = "certs/domainb.key"
 				},
 			},
 		},
+		{
+			name: "autoCert domains don't require certificate files",
+			input: `
+stateDir = "/var/lib/gemini"
+
+[domain.localhost]
+path = "localhost/gemini"
+autoCert = true
+			`,
+			expected: serverConfig{Port: 1965,
+				ReadTimeout:  time.Second * 5,
+				WriteTimeout: time.Second * 10,
+				StateDir:     "/var/lib/gemini",
+				Domain: map[string]domainConfig{
+					"localhost": {
+						Path:     "localhost/gemini",
+						AutoCert: true,
+					},
+				},
+			},
+		},
+		{
+			name: "domains can set default metadata",
+			input: `
+[domain.localhost]
+path = "localhost/gemini"
+autoCert = true
+
+[domain.localhost.metadata]
+lang = "en"
+
+[domain.localhost.metadata.status]
+"old.gmi" = "52 gone"
+
+[domain.localhost.metadata.listing]
+hideDotFiles = true
+sortBy = "date"
+			`,
+			expected: serverConfig{Port: 1965,
+				ReadTimeout:  time.Second * 5,
+				WriteTimeout: time.Second * 10,
+				Domain: map[string]domainConfig{
+					"localhost": {
+						Path:     "localhost/gemini",
+						AutoCert: true,
+						Metadata: gemini.Metadata{
+							Lang:   "en",
+							Status: map[string]string{"old.gmi": "52 gone"},
+							Listing: &gemini.DirectoryListing{
+								HideDotFiles: true,
+								SortBy:       gemini.SortByDate,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "domains can configure the file server",
+			input: `
+[domain.localhost]
+path = "localhost/gemini"
+autoCert = true
+indexFiles = ["index.gmi", "index.txt"]
+symlinks = "withinRoot"
+hideDotFiles = true
+
+[domain.localhost.errors]
+"51" = "31 /not-found.gmi"
+
+[domain.localhost.cache]
+maxSize = 1048576
+checkInterval = "10s"
+			`,
+			expected: serverConfig{Port: 1965,
+				ReadTimeout:  time.Second * 5,
+				WriteTimeout: time.Second * 10,
+				Domain: map[string]domainConfig{
+					"localhost": {
+						Path:         "localhost/gemini",
+						AutoCert:     true,
+						IndexFiles:   []string{"index.gmi", "index.txt"},
+						Errors:       map[string]string{"51": "31 /not-found.gmi"},
+						Symlinks:     gemini.SymlinksWithinRoot,
+						HideDotFiles: true,
+						Cache: &gemini.CacheOptions{
+							MaxSize:       1048576,
+							CheckInterval: time.Second * 10,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "autoCert domains require both certificate files if either is set",
+			input: `
+[domain.localhost]
+path = "localhost/gemini"
+certFilePath = "certs/localhost.cert"
+autoCert = true
+			`,
+			wantErr:     true,
+			expectedErr: errAutoCertFilesIncomplete,
+		},
 	}
 
 	for _, tt := range tests {
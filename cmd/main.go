@@ -11,12 +11,15 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/cert"
+	"github.com/a-h/gemini/log"
 )
 
 var Version = ""
@@ -33,6 +36,9 @@ func main() {
 	case "serve":
 		serve(os.Args[2:])
 		return
+	case "cert":
+		certCommand(os.Args[2:])
+		return
 	case "version":
 		fmt.Println(Version)
 		return
@@ -49,18 +55,23 @@ To see help text, you can run:
 
   gemini request --help
   gemini serve --help
+  gemini cert --help
   gemini version
 
 examples:
 
   gemini request --insecure --verbose gemini://example.com/pass
-  gemini serve --domain=example.com --certFile=server.crt --keyFile=server.key --path=.`)
+  gemini request --input="search terms" gemini://example.com/search
+  gemini request --createIdentity --identity=me gemini://example.com/account
+  gemini serve --domain=example.com --certFile=server.crt --keyFile=server.key --path=.
+  gemini cert generate --domain=example.com --out=server
+  gemini cert inspect gemini://example.com`)
 	os.Exit(1)
 }
 
 func request(args []string) {
 	ctx, cancel := context.WithCancel(context.Background())
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
@@ -73,11 +84,17 @@ func request(args []string) {
 	insecureFlag := cmd.Bool("insecure", false, "Allow any server certificate.")
 	certFileFlag := cmd.String("certFile", "", "Path to a client certificate file (must also set keyFile if this is used).")
 	keyFileFlag := cmd.String("keyFile", "", "Path to a client key file (must also set certFile if this is used).")
+	identityFlag := cmd.String("identity", "", "Name of a client identity stored in identityDir to present to the server.")
+	identityDirFlag := cmd.String("identityDir", defaultIdentityDir(), "Directory containing client identities.")
+	inputFlag := cmd.String("input", "", "Input to send if the server prompts for input (status 10 or 11), instead of reading it from the terminal.")
+	createIdentityFlag := cmd.Bool("createIdentity", false, "Create a client identity, scoped to the host, if the server requires a certificate. The identity is named after the identity flag, or the host if not set.")
 	verboseFlag := cmd.Bool("verbose", false, "Print both headers and body.")
 	headersFlag := cmd.Bool("headers", false, "Print only the headers.")
 	allowBinaryFlag := cmd.Bool("allowBinary", false, "Set to true to enable printing binary to the console.")
 	readTimeoutFlag := cmd.Duration("readTimeout", time.Second*5, "Set the duration, e.g. 1m or 5s.")
 	writeTimeoutFlag := cmd.Duration("writeTimeout", time.Second*5, "Set the duration, e.g. 1m or 5s.")
+	retryFlag := cmd.Int("retry", 0, "Number of times to retry temporary failures (4x), with exponential backoff. 44 (slow down) responses are retried after the requested delay.")
+	maxBodySizeFlag := cmd.Int64("maxBodySize", 0, "Maximum number of bytes of response body to read, 0 for no limit.")
 	helpFlag := cmd.Bool("help", false, "Print help and exit.")
 	err := cmd.Parse(args)
 	if err != nil || *helpFlag {
@@ -98,6 +115,10 @@ func request(args []string) {
 	client := gemini.NewClient()
 	client.ReadTimeout = *readTimeoutFlag
 	client.WriteTimeout = *writeTimeoutFlag
+	client.MaxBodySize = *maxBodySizeFlag
+	if *retryFlag > 0 {
+		client.Retry = gemini.NewRetryPolicy(*retryFlag)
+	}
 	if *insecureFlag {
 		client.Insecure = true
 	}
@@ -107,16 +128,81 @@ func request(args []string) {
 			fmt.Printf("Failed to parse certFile / keyFile: %v\n", err)
 			os.Exit(1)
 		}
-		client.AddClientCertificate("/", keyPair)
+		client.AddClientCertificate("", keyPair)
 	}
-	var authenticated, ok bool
-	var resp *gemini.Response
-	var certificates []string
-	if *noTLSFlag {
-		ok = true // No server validation takes place.
-		resp, err = client.RequestNoTLS(ctx, u)
-	} else {
-		resp, certificates, authenticated, ok, err = client.RequestURL(ctx, u)
+	var identities *gemini.IdentityStore
+	if *identityFlag != "" || *createIdentityFlag {
+		identities, err = gemini.LoadIdentityStore(*identityDirFlag)
+		if err != nil {
+			fmt.Printf("Failed to load identities: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *identityFlag != "" {
+		if id, ok := identities.Get(*identityFlag); ok {
+			client.AddClientCertificate("", id.Certificate)
+		} else if !*createIdentityFlag {
+			fmt.Printf("Identity %q not found in %q.\n", *identityFlag, *identityDirFlag)
+			os.Exit(1)
+		}
+	} else if *createIdentityFlag {
+		// Reuse an identity created by a previous request.
+		if id, ok := identities.Match(u); ok {
+			client.AddClientCertificate("", id.Certificate)
+		}
+	}
+	_, hasCertificate := client.GetCertificate(u)
+	resp, certificates, authenticated, ok, err := makeRequest(ctx, client, u, *noTLSFlag)
+	if err == nil && resp != nil && resp.Header.Code == gemini.CodeClientCertificateRequired && !hasCertificate && *createIdentityFlag {
+		name := *identityFlag
+		if name == "" {
+			name = u.Hostname()
+		}
+		id, err := identities.Generate(name, gemini.ScopeForURL(u), time.Hour*24*365*10)
+		if errors.Is(err, gemini.ErrIdentityExists) {
+			fmt.Printf("Identity %q already exists in %q, but isn't scoped to %q. Select it with --identity, or choose another name.\n", name, *identityDirFlag, u.String())
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Failed to create identity: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created identity %q for %q.\n", id.Name, id.Scope)
+		resp.Body.Close()
+		client.AddClientCertificate("", id.Certificate)
+		hasCertificate = true
+		resp, certificates, authenticated, ok, err = makeRequest(ctx, client, u, *noTLSFlag)
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	for prompts := 0; err == nil && resp != nil && isInputCode(resp.Header.Code); prompts++ {
+		var input string
+		if *inputFlag != "" {
+			if prompts > 0 {
+				// The server didn't accept the input, so there's no point sending it again.
+				break
+			}
+			input = *inputFlag
+		} else {
+			if !isTerminal(os.Stdin) {
+				break
+			}
+			fmt.Printf("%s: ", resp.Header.Meta)
+			input, err = readLine(ctx, stdin, resp.Header.Code == gemini.CodeInputSensitive)
+			if errors.Is(err, context.Canceled) {
+				os.Exit(1)
+			}
+			if errors.Is(err, errEchoNotDisabled) {
+				fmt.Printf("Failed to read input: %v, set the input flag instead.\n", err)
+				os.Exit(1)
+			}
+			if err != nil {
+				fmt.Printf("Failed to read input: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		resp.Body.Close()
+		u = gemini.WithInput(u, input)
+		resp, certificates, authenticated, ok, err = makeRequest(ctx, client, u, *noTLSFlag)
 	}
 	if err != nil {
 		fmt.Printf("Request failed: %v\n", err)
@@ -129,13 +215,18 @@ func request(args []string) {
 		}
 		os.Exit(1)
 	}
-	if *certFileFlag != "" && !authenticated {
+	if hasCertificate && !*noTLSFlag && !authenticated {
 		fmt.Println("Authentication failed, the certificate was rejected by the server.")
 		os.Exit(1)
 	}
 	if *verboseFlag || *headersFlag {
 		fmt.Printf("%v %v\r\n", resp.Header.Code, resp.Header.Meta)
 	}
+	if isInputCode(resp.Header.Code) {
+		fmt.Printf("Input required: %s\n", resp.Header.Meta)
+		fmt.Println("Run in a terminal to enter input, or set the input flag.")
+		os.Exit(1)
+	}
 	if *headersFlag != true && !gemini.IsErrorCode(resp.Header.Code) {
 		if strings.HasPrefix(resp.Header.Meta, "text/") {
 			s := bufio.NewScanner(resp.Body)
@@ -164,6 +255,27 @@ func request(args []string) {
 	}
 }
 
+func isInputCode(code gemini.Code) bool {
+	return code == gemini.CodeInput || code == gemini.CodeInputSensitive
+}
+
+func makeRequest(ctx context.Context, client *gemini.Client, u *url.URL, noTLS bool) (resp *gemini.Response, certificates []string, authenticated, ok bool, err error) {
+	if noTLS {
+		ok = true // No server validation takes place.
+		resp, err = client.RequestNoTLS(ctx, u)
+		return
+	}
+	return client.RequestURL(ctx, u)
+}
+
+func defaultIdentityDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "identities"
+	}
+	return filepath.Join(dir, "gemini", "identities")
+}
+
 func newServerConfig() serverConfig {
 	return serverConfig{
 		Domain:       make(map[string]domainConfig),
@@ -178,25 +290,64 @@ type serverConfig struct {
 	Port         int
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// StateDir is where automatically generated certificates are stored.
+	StateDir string
 }
 
 type domainConfig struct {
 	Path         string
 	CertFilePath string
 	KeyFilePath  string
+	// AutoCert generates a self-signed certificate on first start. If CertFilePath and
+	// KeyFilePath are set, the certificate is written to them, otherwise it's stored in
+	// the StateDir.
+	AutoCert bool
+	// Metadata applies to every directory of the domain, unless overridden by a .meta file.
+	Metadata gemini.Metadata
+	// MetadataFiles reads .meta files from the directories of the domain.
+	MetadataFiles bool
+	// IndexFiles used to serve directories, in order of preference.
+	IndexFiles []string
+	// Errors replaces error responses by status code, e.g. "51" = "31 /not-found.gmi".
+	Errors map[string]string
+	// Symlinks is "follow" (the default), "refuse" or "withinRoot".
+	Symlinks gemini.SymlinkPolicy
+	// HideDotFiles stops files whose names start with a dot from being served or listed.
+	HideDotFiles bool
+	// Cache keeps files and directory listings in memory, if set.
+	Cache *gemini.CacheOptions
+}
+
+func (dc domainConfig) fileServerOptions() gemini.FileServerOptions {
+	return gemini.FileServerOptions{
+		IndexFiles:    dc.IndexFiles,
+		Errors:        dc.Errors,
+		Symlinks:      dc.Symlinks,
+		HideDotFiles:  dc.HideDotFiles,
+		Metadata:      dc.Metadata,
+		MetadataFiles: dc.MetadataFiles,
+	}
 }
 
+var errAutoCertFilesIncomplete = errors.New("autoCert requires both or neither of cert file and key file to be configured")
+
 func (dc domainConfig) IsValid(name string) error {
 	var errs []error
 	if dc.Path == "" {
 		errs = append(errs, fmt.Errorf("%s: no path configured", name))
 	}
-	if dc.CertFilePath == "" {
+	if dc.AutoCert && (dc.CertFilePath == "") != (dc.KeyFilePath == "") {
+		errs = append(errs, fmt.Errorf("%s: %w", name, errAutoCertFilesIncomplete))
+	}
+	if !dc.AutoCert && dc.CertFilePath == "" {
 		errs = append(errs, fmt.Errorf("%s: no cert file configured", name))
 	}
-	if dc.KeyFilePath == "" {
+	if !dc.AutoCert && dc.KeyFilePath == "" {
 		errs = append(errs, fmt.Errorf("%s: no key file configured", name))
 	}
+	if err := dc.fileServerOptions().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
 	return errors.Join(errs...)
 }
 
@@ -235,13 +386,16 @@ var (
 	defaultWriteTimeout = time.Second * 10
 	defaultPort         = 1965
 	defaultPath         = "."
+	defaultStateDir     = "state"
 )
 
 func serve(args []string) {
 	// Parse flags.
 	cmd := flag.NewFlagSet("serve", flag.ExitOnError)
-	certFileFlag := cmd.String("certFile", "", "(required) Path to a server certificate file (must also set keyFile if this is used).")
-	keyFileFlag := cmd.String("keyFile", "", "(required) Path to a server key file (must also set certFile if this is used).")
+	certFileFlag := cmd.String("certFile", "", "(required unless autoCert is set) Path to a server certificate file (must also set keyFile if this is used).")
+	keyFileFlag := cmd.String("keyFile", "", "(required unless autoCert is set) Path to a server key file (must also set certFile if this is used).")
+	autoCertFlag := cmd.Bool("autoCert", false, "Generate a self-signed certificate for the domain on first start, and reuse it on subsequent starts.")
+	stateDirFlag := cmd.String("stateDir", defaultStateDir, "Directory to store automatically generated certificates in.")
 	domainFlag := cmd.String("domain", "localhost", "The domain to listen on.")
 	pathFlag := cmd.String("path", defaultPath, "Path containing content.")
 	portFlag := cmd.Int("port", defaultPort, "Address to listen on.")
@@ -271,8 +425,8 @@ func serve(args []string) {
 			os.Exit(1)
 		}
 	} else {
-		if *certFileFlag == "" || *keyFileFlag == "" {
-			fmt.Println("error: require certFile and keyFile flags to create server")
+		if !*autoCertFlag && (*certFileFlag == "" || *keyFileFlag == "") {
+			fmt.Println("error: require certFile and keyFile flags, or the autoCert flag to create server")
 			fmt.Println()
 			cmd.PrintDefaults()
 			os.Exit(1)
@@ -280,26 +434,66 @@ func serve(args []string) {
 		serverConfig.Port = *portFlag
 		serverConfig.ReadTimeout = *readTimeoutFlag
 		serverConfig.WriteTimeout = *writeTimeoutFlag
+		serverConfig.StateDir = *stateDirFlag
 		serverConfig.Domain[*domainFlag] = domainConfig{
 			Path:         *pathFlag,
 			CertFilePath: *certFileFlag,
 			KeyFilePath:  *keyFileFlag,
+			AutoCert:     *autoCertFlag,
 		}
 	}
+	if serverConfig.StateDir == "" {
+		serverConfig.StateDir = defaultStateDir
+	}
 
 	// Create handlers.
+	var store cert.Store
+	var archives []*gemini.Archive
+	caches := make(map[string]*gemini.Cache)
 	domainToHandler := make(map[string]*gemini.DomainHandler)
 	for domain, config := range serverConfig.Domain {
-		h := gemini.FileSystemHandler(gemini.Dir(config.Path))
-		cert, err := tls.LoadX509KeyPair(config.CertFilePath, config.KeyFilePath)
+		var fs gemini.FileSystem = gemini.Dir(config.Path)
+		if gemini.IsArchive(config.Path) {
+			a, err := gemini.OpenArchive(config.Path)
+			if err != nil {
+				fmt.Printf("error: failed to open archive for domain %q: %v\n", domain, err)
+				os.Exit(1)
+			}
+			archives = append(archives, a)
+			fs = a
+		}
+		if config.Cache != nil {
+			c := gemini.NewCache(fs, *config.Cache)
+			caches[domain] = c
+			fs = c
+		}
+		h := gemini.FileSystemHandlerWithOptions(fs, config.fileServerOptions())
+		var keyPair tls.Certificate
+		if config.AutoCert && config.CertFilePath != "" {
+			keyPair, _, err = loadOrGenerateCertificate(keyPairFiles{certFile: config.CertFilePath, keyFile: config.KeyFilePath}, strings.ToLower(domain))
+		} else if config.AutoCert {
+			if store == nil {
+				if store, err = cert.NewFileStore(serverConfig.StateDir); err != nil {
+					fmt.Printf("error: failed to create state directory: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			keyPair, _, err = loadOrGenerateCertificate(store, strings.ToLower(domain))
+		} else {
+			keyPair, err = tls.LoadX509KeyPair(config.CertFilePath, config.KeyFilePath)
+		}
 		if err != nil {
 			fmt.Printf("error: failed to load certificates for domain %q: %v\n", domain, err)
 			os.Exit(1)
 		}
-		dh := gemini.NewDomainHandler(domain, cert, h)
+		dh := gemini.NewDomainHandler(domain, keyPair, h)
 		domainToHandler[strings.ToLower(domain)] = dh
 	}
 
+	if len(archives) > 0 || len(caches) > 0 {
+		go reloadOnSignal(archives, caches)
+	}
+
 	// Start server.
 	ctx := context.Background()
 	server := gemini.NewServer(ctx, fmt.Sprintf(":%d", serverConfig.Port), domainToHandler)
@@ -311,3 +505,26 @@ func serve(args []string) {
 		os.Exit(1)
 	}
 }
+
+// reloadOnSignal reloads the content archives and purges the caches when the process
+// receives a SIGHUP, so that a site can be updated by replacing its archive or files.
+func reloadOnSignal(archives []*gemini.Archive, caches map[string]*gemini.Cache) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		for _, a := range archives {
+			if err := a.Reload(); err != nil {
+				log.Error("serve: failed to reload archive", err, log.String("path", a.Path))
+				continue
+			}
+			log.Info("serve: reloaded archive", log.String("path", a.Path))
+		}
+		for domain, cache := range caches {
+			stats := cache.Stats()
+			cache.Purge()
+			log.Info("serve: purged cache", log.String("domain", domain),
+				log.Int64("hits", int64(stats.Hits)), log.Int64("misses", int64(stats.Misses)),
+				log.Int64("evictions", int64(stats.Evictions)), log.Int("entries", stats.Entries))
+		}
+	}
+}
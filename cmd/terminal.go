@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// isTerminal returns true if f is a terminal, rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// errEchoNotDisabled is returned when sensitive input is requested, but the terminal
+// can't be configured to stop echoing the input.
+var errEchoNotDisabled = errors.New("unable to hide sensitive input on this terminal")
+
+// readLine reads a line of input from the terminal. If sensitive is set, the input is
+// not echoed back to the terminal while it's typed, and errEchoNotDisabled is returned
+// if that isn't possible. If ctx is cancelled before the line is complete, the context
+// error is returned.
+func readLine(ctx context.Context, r *bufio.Reader, sensitive bool) (line string, err error) {
+	if sensitive {
+		if err = stty("-echo"); err != nil {
+			return "", errEchoNotDisabled
+		}
+		defer func() {
+			stty("echo")
+			// The newline typed by the user wasn't echoed.
+			fmt.Println()
+		}()
+	}
+	type result struct {
+		line string
+		err  error
+	}
+	read := make(chan result, 1)
+	go func() {
+		line, err := r.ReadString('\n')
+		read <- result{line: line, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-read:
+		if res.err != nil {
+			return "", res.err
+		}
+		return strings.TrimRight(res.line, "\r\n"), nil
+	}
+}
+
+// stty configures the terminal attached to stdin. It's not available on all platforms.
+func stty(args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadLine(t *testing.T) {
+	line, err := readLine(context.Background(), bufio.NewReader(strings.NewReader("input\r\n")), false)
+	if err != nil {
+		t.Fatalf("failed to read line: %v", err)
+	}
+	if line != "input" {
+		t.Errorf("expected %q, got %q", "input", line)
+	}
+}
+
+func TestReadLineCancel(t *testing.T) {
+	// The pipe is never written to, so the read blocks until the context is cancelled.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := readLine(ctx, bufio.NewReader(pr), false); err != context.DeadlineExceeded {
+		t.Errorf("expected the read to be cancelled, got %v", err)
+	}
+}
+
+func TestReadLineSensitiveWithoutTerminal(t *testing.T) {
+	// stty can't disable echo when stdin is a pipe.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	stdin := os.Stdin
+	os.Stdin = pr
+	defer func() { os.Stdin = stdin }()
+	if _, err = readLine(context.Background(), bufio.NewReader(strings.NewReader("secret\n")), true); err != errEchoNotDisabled {
+		t.Errorf("expected errEchoNotDisabled, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package gemini
+
+import (
+	"crypto/x509"
+	"errors"
+	"sort"
+	"time"
+
+	certpkg "github.com/a-h/gemini/cert"
+	"github.com/a-h/gemini/log"
+)
+
+// DefaultExpiryWarnings are the thresholds at which the Server logs warnings about certificates that are about to expire.
+var DefaultExpiryWarnings = []time.Duration{
+	time.Hour * 24 * 30,
+	time.Hour * 24 * 7,
+	time.Hour * 24,
+}
+
+// CertificateExpiry describes when the certificate of a domain expires.
+type CertificateExpiry struct {
+	ServerName  string
+	Fingerprint string
+	NotAfter    time.Time
+	// Error is set if the certificate could not be parsed.
+	Error string
+}
+
+// Remaining returns the time until the certificate expires.
+func (ce CertificateExpiry) Remaining(now time.Time) time.Duration {
+	return ce.NotAfter.Sub(now)
+}
+
+// DaysRemaining returns the number of whole days until the certificate expires. It's
+// negative if the certificate has expired.
+func (ce CertificateExpiry) DaysRemaining(now time.Time) int {
+	return int(ce.Remaining(now).Hours() / 24)
+}
+
+// CertificateExpiries returns the expiry of the certificate of every domain, ordered by server name.
+func (srv *Server) CertificateExpiries() (expiries []CertificateExpiry) {
+	for name, dh := range srv.DomainToHandler {
+		ce := CertificateExpiry{
+			ServerName: name,
+		}
+		leaf, err := leafCertificate(dh)
+		if err != nil {
+			ce.Error = err.Error()
+		} else {
+			ce.Fingerprint = certpkg.Fingerprint(leaf)
+			ce.NotAfter = leaf.NotAfter
+		}
+		expiries = append(expiries, ce)
+	}
+	sort.Slice(expiries, func(i, j int) bool { return expiries[i].ServerName < expiries[j].ServerName })
+	return
+}
+
+var errNoCertificate = errors.New("gemini: no certificate")
+
+func leafCertificate(dh *DomainHandler) (*x509.Certificate, error) {
+	if dh.KeyPair.Leaf != nil {
+		return dh.KeyPair.Leaf, nil
+	}
+	if len(dh.KeyPair.Certificate) == 0 {
+		return nil, errNoCertificate
+	}
+	return x509.ParseCertificate(dh.KeyPair.Certificate[0])
+}
+
+// checkExpiry logs a warning for each certificate that expires within one of the ExpiryWarnings
+// thresholds, and an error for each certificate that has expired. It returns the number of
+// certificates that were logged.
+func (srv *Server) checkExpiry(now time.Time) (count int) {
+	warnings := srv.ExpiryWarnings
+	if warnings == nil {
+		warnings = DefaultExpiryWarnings
+	}
+	for _, ce := range srv.CertificateExpiries() {
+		if ce.Error != "" {
+			log.Warn("gemini: failed to check certificate expiry", log.String("serverName", ce.ServerName), log.String("reason", ce.Error))
+			continue
+		}
+		remaining := ce.Remaining(now)
+		if remaining <= 0 {
+			log.Error("gemini: certificate expired", nil,
+				log.String("serverName", ce.ServerName),
+				log.String("fingerprint", ce.Fingerprint),
+				log.String("notAfter", ce.NotAfter.Format(time.RFC3339)))
+			count++
+			continue
+		}
+		// Find the smallest threshold that the certificate is within.
+		var threshold time.Duration
+		for _, w := range warnings {
+			if remaining <= w && (threshold == 0 || w < threshold) {
+				threshold = w
+			}
+		}
+		if threshold == 0 {
+			continue
+		}
+		log.Warn("gemini: certificate expires soon",
+			log.String("serverName", ce.ServerName),
+			log.String("fingerprint", ce.Fingerprint),
+			log.String("notAfter", ce.NotAfter.Format(time.RFC3339)),
+			log.Int("daysRemaining", ce.DaysRemaining(now)),
+			log.String("threshold", threshold.String()))
+		count++
+	}
+	return
+}
+
+// monitorExpiry checks the expiry of certificates on start, and at every ExpiryCheckInterval
+// until the server's context is done.
+func (srv *Server) monitorExpiry() {
+	srv.checkExpiry(time.Now())
+	interval := srv.ExpiryCheckInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-srv.Context.Done():
+			return
+		case now := <-ticker.C:
+			srv.checkExpiry(now)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/a-h/gemini/cert"
+)
+
+func TestCertificateExpiry(t *testing.T) {
+	newKeyPair := func(duration time.Duration) tls.Certificate {
+		certPEM, keyPEM, err := cert.GenerateServer(cert.Options{CommonName: "example.com", Duration: duration})
+		if err != nil {
+			t.Fatalf("failed to generate certificate: %v", err)
+		}
+		kp, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatalf("failed to load certificate: %v", err)
+		}
+		kp.Leaf = nil
+		return kp
+	}
+	srv := NewServer(context.Background(), "", map[string]*DomainHandler{
+		"long":    NewDomainHandler("long", newKeyPair(time.Hour*24*365), nil),
+		"month":   NewDomainHandler("month", newKeyPair(time.Hour*24*20), nil),
+		"day":     NewDomainHandler("day", newKeyPair(time.Hour*12), nil),
+		"missing": NewDomainHandler("missing", tls.Certificate{}, nil),
+	})
+
+	now := time.Now()
+	expiries := srv.CertificateExpiries()
+	expectedDays := map[string]int{
+		"day":   0,
+		"long":  364,
+		"month": 19,
+	}
+	if len(expiries) != 4 {
+		t.Fatalf("expected 4 expiries, got %d", len(expiries))
+	}
+	for i, name := range []string{"day", "long", "missing", "month"} {
+		ce := expiries[i]
+		if ce.ServerName != name {
+			t.Errorf("[%d] expected server name %q, got %q", i, name, ce.ServerName)
+		}
+		if name == "missing" {
+			if ce.Error == "" {
+				t.Errorf("expected an error for a domain without a certificate")
+			}
+			continue
+		}
+		if ce.Fingerprint == "" {
+			t.Errorf("%s: expected a fingerprint", name)
+		}
+		if days := ce.DaysRemaining(now); days != expectedDays[name] {
+			t.Errorf("%s: expected %d days remaining, got %d", name, expectedDays[name], days)
+		}
+	}
+
+	if count := srv.checkExpiry(now); count != 2 {
+		t.Errorf("expected 2 certificates to be logged as expiring, got %d", count)
+	}
+	if count := srv.checkExpiry(now.Add(time.Hour * 24 * 400)); count != 3 {
+		t.Errorf("expected 3 certificates to be logged as expired, got %d", count)
+	}
+	srv.ExpiryWarnings = []time.Duration{time.Hour}
+	if count := srv.checkExpiry(now); count != 0 {
+		t.Errorf("expected no certificates to be within a 1 hour threshold, got %d", count)
+	}
+}
@@ -4,12 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime"
-	"net/url"
 	"os"
 	"path"
 	"path/filepath"
-	"sort"
 	"strings"
 
 	"github.com/a-h/gemini/log"
@@ -46,35 +45,16 @@ type File interface {
 	Stat() (os.FileInfo, error)
 }
 
-func DirectoryListingHandler(path string, f File) Handler {
-	return HandlerFunc(func(w ResponseWriter, r *Request) {
-		files, err := f.Readdir(-1)
-		if err != nil {
-			log.Warn("DirectoryListingHandler: readdir failed", log.String("reason", err.Error()), log.String("path", r.URL.Path), log.String("url", r.URL.String()))
-			w.SetHeader(CodeTemporaryFailure, "readdir failed")
-			return
-		}
-		sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
-		w.SetHeader(CodeSuccess, DefaultMIMEType)
-		fmt.Fprintf(w, "# Index of %s\n\n", path)
-		fmt.Fprintln(w, "=> ../")
-		for _, ff := range files {
-			name := ff.Name()
-			if ff.IsDir() {
-				name += "/"
-			}
-			url := url.URL{Path: name}
-			fmt.Fprintf(w, "=> %v\n", url.String())
-		}
-	})
+func FileContentHandler(name string, f File) Handler {
+	mType := mime.TypeByExtension(path.Ext(name))
+	if mType == "" {
+		mType = DefaultMIMEType
+	}
+	return fileContentHandler(name, mType, f)
 }
 
-func FileContentHandler(name string, f File) Handler {
+func fileContentHandler(name, mType string, f File) Handler {
 	return HandlerFunc(func(w ResponseWriter, r *Request) {
-		mType := mime.TypeByExtension(path.Ext(name))
-		if mType == "" {
-			mType = DefaultMIMEType
-		}
 		w.SetHeader(CodeSuccess, mType)
 		if _, err := io.Copy(w, f); err != nil {
 			log.Error("FileContentHandler: failed to write file", err, log.String("fileName", name))
@@ -83,46 +63,210 @@ func FileContentHandler(name string, f File) Handler {
 	})
 }
 
-func FileSystemHandler(fs FileSystem) Handler {
+// FileSystemHandler serves the files in fsys. Directories are served using their index.gmi
+// file, or a listing if they don't have one.
+func FileSystemHandler(fsys FileSystem) Handler {
+	return FileSystemHandlerWithOptions(fsys, FileServerOptions{})
+}
+
+// FileSystemHandlerWithMetadata serves the files in fsys, see FileSystemHandler. Metadata
+// files (.meta) in each directory can set the MIME type, language and charset of files, a
+// custom status, or configure the listing, see Metadata. The defaults apply to all files,
+// unless overridden by metadata files.
+func FileSystemHandlerWithMetadata(fsys FileSystem, defaults Metadata) Handler {
+	return FileSystemHandlerWithOptions(fsys, FileServerOptions{Metadata: defaults, MetadataFiles: true})
+}
+
+// DefaultIndexFiles are the names of the files used to serve directories.
+var DefaultIndexFiles = []string{"index.gmi"}
+
+// FileServerOptions configures FileSystemHandlerWithOptions.
+type FileServerOptions struct {
+	// IndexFiles are the names of the files used to serve a directory, in order of
+	// preference. Defaults to DefaultIndexFiles.
+	IndexFiles []string
+	// Errors replaces the responses to errors by status code, e.g. "51" = "51 There's
+	// nothing here", or "51" = "31 /not-found.gmi" to redirect. The value is the status
+	// code, followed by a space and the meta.
+	Errors map[string]string
+	// Symlinks sets how symbolic links are served, defaults to SymlinksFollow.
+	Symlinks SymlinkPolicy
+	// HideDotFiles returns 51 (not found) for files and directories whose names start with
+	// a dot, and leaves them out of directory listings.
+	HideDotFiles bool
+	// Metadata applies to all files, unless overridden by metadata files.
+	Metadata Metadata
+	// MetadataFiles reads the metadata file (.meta) of the directory of each requested
+	// file, and of its parent directories, see Metadata. Metadata files aren't served or
+	// listed. When false, .meta files are served like any other file.
+	MetadataFiles bool
+}
+
+// Validate checks that the error responses, symlink policy and metadata are valid.
+func (o FileServerOptions) Validate() error {
+	for code, status := range o.Errors {
+		if _, err := parseStatus(code); err != nil {
+			return fmt.Errorf("gemini: invalid error code %q: %w", code, err)
+		}
+		if _, err := parseStatus(status); err != nil {
+			return fmt.Errorf("gemini: invalid error response for %q: %w", code, err)
+		}
+	}
+	if err := o.Symlinks.Validate(); err != nil {
+		return err
+	}
+	return o.Metadata.Validate()
+}
+
+// errorHandler writes the error response, replaced by a custom response if one is configured.
+func (o FileServerOptions) errorHandler(code Code, meta string) Handler {
+	if s, ok := o.Errors[string(code)]; ok {
+		if h, err := parseStatus(s); err == nil {
+			code, meta = h.Code, h.Meta
+		}
+	}
 	return HandlerFunc(func(w ResponseWriter, r *Request) {
-		if strings.Contains(r.URL.Path, "..") {
+		w.SetHeader(code, meta)
+	})
+}
+
+// metadataChain returns the metadata that applies to the files in dir.
+func (o FileServerOptions) metadataChain(fsys FileSystem, dir string) metadataChain {
+	if !o.MetadataFiles {
+		return metadataChain{o.Metadata}
+	}
+	return loadMetadataChain(fsys, dir, o.Metadata)
+}
+
+// isHidden returns true if any element of the path starts with a dot.
+func isHidden(p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// FileSystemHandlerWithOptions serves the files in fsys, see FileSystemHandler.
+func FileSystemHandlerWithOptions(fsys FileSystem, opts FileServerOptions) Handler {
+	indexFiles := opts.IndexFiles
+	if len(indexFiles) == 0 {
+		indexFiles = DefaultIndexFiles
+	}
+	// Files read to serve a request, such as metadata files and the titles of files in
+	// listings, are opened using the symlink policy too.
+	restricted := restrictedFS{fsys: fsys, opts: opts}
+	fsys = restricted
+	notFound := opts.errorHandler(CodeNotFound, "not found")
+	badRequest := opts.errorHandler(CodeBadRequest, "bad request")
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if _, ok := validPath(r.URL.Path); !ok {
 			log.Warn("FileSystemHandler: possible directory traversal attack", log.String("path", r.URL.Path), log.String("url", r.URL.String()))
-			BadRequest(w, r)
+			badRequest.ServeGemini(w, r)
 			return
 		}
 		if !strings.HasPrefix(r.URL.Path, "/") {
 			r.URL.Path = "/" + r.URL.Path
 		}
-		f, err := fs.Open(r.URL.Path)
+		dir, name := path.Split(strings.TrimSuffix(r.URL.Path, "/"))
+		if (opts.MetadataFiles && name == MetadataFileName) || (opts.HideDotFiles && isHidden(r.URL.Path)) {
+			notFound.ServeGemini(w, r)
+			return
+		}
+		metadata := opts.metadataChain(fsys, dir)
+		if h, ok := metadata.status(name); ok && name != "" {
+			w.SetHeader(h.Code, h.Meta)
+			return
+		}
+		f, err := fsys.Open(r.URL.Path)
 		if err != nil {
 			if os.IsNotExist(err) {
-				NotFoundHandler().ServeGemini(w, r)
+				notFound.ServeGemini(w, r)
+				return
+			}
+			if errors.Is(err, fs.ErrInvalid) {
+				badRequest.ServeGemini(w, r)
 				return
 			}
 			log.Warn("FileSystemHandler: file open failed", log.String("reason", err.Error()), log.String("path", r.URL.Path), log.String("url", r.URL.String()))
-			w.SetHeader(CodeTemporaryFailure, "file open failed")
+			opts.errorHandler(CodeTemporaryFailure, "file open failed").ServeGemini(w, r)
 			return
 		}
+		defer f.Close()
 		stat, err := f.Stat()
 		if err != nil {
 			log.Warn("FileSystemHandler: file stat failed", log.String("reason", err.Error()), log.String("path", r.URL.Path), log.String("url", r.URL.String()))
-			w.SetHeader(CodeTemporaryFailure, "file stat failed")
+			opts.errorHandler(CodeTemporaryFailure, "file stat failed").ServeGemini(w, r)
 			return
 		}
 		if stat.IsDir() {
-			// Look for index.gmi first before listing contents.
+			// Look for an index file first before listing contents.
 			if !strings.HasSuffix(r.URL.Path, "/") {
 				RedirectPermanentHandler(r.URL.Path+"/").ServeGemini(w, r)
 				return
 			}
-			index, err := fs.Open(r.URL.Path + "index.gmi")
+			metadata = opts.metadataChain(fsys, r.URL.Path)
+			indexName, index, err := openIndex(fsys, r.URL.Path, indexFiles)
 			if errors.Is(err, os.ErrNotExist) {
-				DirectoryListingHandler(r.URL.Path, f).ServeGemini(w, r)
+				listing := metadata.listing()
+				if listing.Disabled {
+					notFound.ServeGemini(w, r)
+					return
+				}
+				listing.HideDotFiles = listing.HideDotFiles || opts.HideDotFiles
+				listing.allow = restricted.allows
+				listing.hideMetadata = opts.MetadataFiles
+				listing.Handler(fsys, r.URL.Path, f).ServeGemini(w, r)
 				return
 			}
-			FileContentHandler("index.gmi", index).ServeGemini(w, r)
+			if err != nil {
+				log.Warn("FileSystemHandler: index open failed", log.String("reason", err.Error()), log.String("path", r.URL.Path), log.String("url", r.URL.String()))
+				opts.errorHandler(CodeTemporaryFailure, "file open failed").ServeGemini(w, r)
+				return
+			}
+			defer index.Close()
+			fileContentHandler(indexName, metadata.mimeType(indexName), index).ServeGemini(w, r)
 			return
 		}
-		FileContentHandler(stat.Name(), f).ServeGemini(w, r)
+		fileContentHandler(stat.Name(), metadata.mimeType(stat.Name()), f).ServeGemini(w, r)
 	})
 }
+
+// restrictedFS opens files if the symlink policy of the options allows it.
+type restrictedFS struct {
+	fsys FileSystem
+	opts FileServerOptions
+}
+
+// Open the named file. os.ErrNotExist is returned if the symlink policy doesn't allow it,
+// to avoid revealing the file.
+func (r restrictedFS) Open(name string) (f File, err error) {
+	ok, err := r.opts.Symlinks.allows(r.fsys, name)
+	if err != nil {
+		return
+	}
+	if !ok {
+		log.Warn("FileSystemHandler: symlink refused", log.String("path", name), log.String("policy", string(r.opts.Symlinks)))
+		err = os.ErrNotExist
+		return
+	}
+	return r.fsys.Open(name)
+}
+
+// allows returns true if the symlink policy allows the named file to be opened.
+func (r restrictedFS) allows(name string) bool {
+	ok, err := r.opts.Symlinks.allows(r.fsys, name)
+	return ok && err == nil
+}
+
+// openIndex opens the first index file that exists in the directory dir.
+func openIndex(fsys FileSystem, dir string, indexFiles []string) (name string, f File, err error) {
+	for _, name = range indexFiles {
+		f, err = fsys.Open(dir + name)
+		if !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+	}
+	return
+}
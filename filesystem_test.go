@@ -7,7 +7,10 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
 )
 
 var geminiSuccessHeader = Header{
@@ -161,3 +164,372 @@ func TestFileSystemBinaryHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestFileSystemHandlerFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.gmi":     &fstest.MapFile{Data: []byte("# Home\n")},
+		"a..b.gmi":      &fstest.MapFile{Data: []byte("# a..b\n")},
+		"dir/file.gmi":  &fstest.MapFile{Data: []byte("# File\n")},
+		"dir/other.gmi": &fstest.MapFile{Data: []byte("# Other\n")},
+	}
+	var tests = []struct {
+		name           string
+		url            string
+		expectedHeader Header
+		expectedBody   string
+	}{
+		{
+			name:           "the index of the root is served",
+			url:            "/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Home\n",
+		},
+		{
+			name:           "names containing dots are served",
+			url:            "/a..b.gmi",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# a..b\n",
+		},
+		{
+			name:           "directories are listed",
+			url:            "/dir/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /dir/\n\n=> ../\n=> file.gmi\n=> other.gmi\n",
+		},
+		{
+			name:           "directories without a trailing slash are redirected",
+			url:            "/dir",
+			expectedHeader: Header{Code: CodeRedirectPermanent, Meta: "/dir/"},
+		},
+		{
+			name:           "missing files return a 51",
+			url:            "/missing.gmi",
+			expectedHeader: Header{Code: CodeNotFound, Meta: "not found"},
+		},
+		{
+			name:           "parent directory elements are rejected",
+			url:            "/dir/../index.gmi",
+			expectedHeader: Header{Code: CodeBadRequest, Meta: "bad request"},
+		},
+		{
+			name:           "current directory elements are rejected",
+			url:            "/./index.gmi",
+			expectedHeader: Header{Code: CodeBadRequest, Meta: "bad request"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := FileSystemHandler(FS(fsys))
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Path: tt.url},
+			}
+			resp, err := Record(r, h)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedHeader.Code != resp.Header.Code || tt.expectedHeader.Meta != resp.Header.Meta {
+				t.Errorf("expected header %v, got %v", tt.expectedHeader, *resp.Header)
+			}
+			bdy, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if tt.expectedBody != string(bdy) {
+				t.Errorf("expected\n%v\nactual\n%v", tt.expectedBody, string(bdy))
+			}
+		})
+	}
+}
+
+func TestFileSystemHandlerOptions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.txt":       &fstest.MapFile{Data: []byte("Home")},
+		"docs/index.gmi":  &fstest.MapFile{Data: []byte("# Docs\n")},
+		"docs/index.txt":  &fstest.MapFile{Data: []byte("Docs")},
+		"list/.hidden":    &fstest.MapFile{Data: []byte("hidden")},
+		"list/a.gmi":      &fstest.MapFile{Data: []byte("# A\n")},
+		".git/config":     &fstest.MapFile{Data: []byte("secret")},
+		".well-known/key": &fstest.MapFile{Data: []byte("key")},
+	}
+	var tests = []struct {
+		name           string
+		opts           FileServerOptions
+		url            string
+		expectedHeader Header
+		expectedBody   string
+	}{
+		{
+			name:           "index files are used in order of preference",
+			opts:           FileServerOptions{IndexFiles: []string{"index.gmi", "index.txt"}},
+			url:            "/docs/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Docs\n",
+		},
+		{
+			name:           "later index files are used if earlier ones don't exist",
+			opts:           FileServerOptions{IndexFiles: []string{"index.gmi", "index.txt"}},
+			url:            "/",
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/plain; charset=utf-8"},
+			expectedBody:   "Home",
+		},
+		{
+			name:           "hidden files are served by default",
+			url:            "/.git/config",
+			expectedHeader: Header{Code: CodeSuccess, Meta: DefaultMIMEType},
+			expectedBody:   "secret",
+		},
+		{
+			name:           "hidden files can be hidden",
+			opts:           FileServerOptions{HideDotFiles: true},
+			url:            "/.git/config",
+			expectedHeader: Header{Code: CodeNotFound, Meta: "not found"},
+		},
+		{
+			name:           "hidden files are left out of listings",
+			opts:           FileServerOptions{HideDotFiles: true},
+			url:            "/list/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /list/\n\n=> ../\n=> a.gmi\n",
+		},
+		{
+			name:           "error responses can be customised",
+			opts:           FileServerOptions{Errors: map[string]string{"51": "51 There's nothing here"}},
+			url:            "/missing.gmi",
+			expectedHeader: Header{Code: CodeNotFound, Meta: "There's nothing here"},
+		},
+		{
+			name:           "errors can be redirected",
+			opts:           FileServerOptions{Errors: map[string]string{"51": "31 /not-found.gmi"}},
+			url:            "/missing.gmi",
+			expectedHeader: Header{Code: CodeRedirectPermanent, Meta: "/not-found.gmi"},
+		},
+		{
+			name:           "custom error responses apply to hidden files",
+			opts:           FileServerOptions{HideDotFiles: true, Errors: map[string]string{"51": "51 There's nothing here"}},
+			url:            "/.well-known/key",
+			expectedHeader: Header{Code: CodeNotFound, Meta: "There's nothing here"},
+		},
+		{
+			name:           "custom error responses apply to bad requests",
+			opts:           FileServerOptions{Errors: map[string]string{"59": "59 Nope"}},
+			url:            "/../index.txt",
+			expectedHeader: Header{Code: CodeBadRequest, Meta: "Nope"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); err != nil {
+				t.Fatalf("unexpected error validating options: %v", err)
+			}
+			h := FileSystemHandlerWithOptions(FS(fsys), tt.opts)
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Path: tt.url},
+			}
+			resp, err := Record(r, h)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedHeader.Code != resp.Header.Code || tt.expectedHeader.Meta != resp.Header.Meta {
+				t.Errorf("expected header %v, got %v", tt.expectedHeader, *resp.Header)
+			}
+			bdy, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if tt.expectedBody != string(bdy) {
+				t.Errorf("expected\n%v\nactual\n%v", tt.expectedBody, string(bdy))
+			}
+		})
+	}
+}
+
+func TestFileServerOptionsValidate(t *testing.T) {
+	var tests = []struct {
+		name    string
+		opts    FileServerOptions
+		wantErr bool
+	}{
+		{
+			name: "the zero value is valid",
+		},
+		{
+			name:    "error codes must be status codes",
+			opts:    FileServerOptions{Errors: map[string]string{"not found": "51 gone"}},
+			wantErr: true,
+		},
+		{
+			name:    "error responses must start with a status code",
+			opts:    FileServerOptions{Errors: map[string]string{"51": "gone"}},
+			wantErr: true,
+		},
+		{
+			name:    "symlink policies must be known",
+			opts:    FileServerOptions{Symlinks: "sometimes"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFileSystemHandlerSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret.gmi"), []byte("# Secret\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "page.gmi"), []byte("# Page\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "page.gmi"), filepath.Join(root, "inside.gmi")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.gmi"), filepath.Join(root, "outside.gmi")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "outsidedir")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	notFound := Header{Code: CodeNotFound, Meta: "not found"}
+	var tests = []struct {
+		policy   SymlinkPolicy
+		url      string
+		expected Header
+	}{
+		{policy: SymlinksFollow, url: "/page.gmi", expected: geminiSuccessHeader},
+		{policy: SymlinksFollow, url: "/inside.gmi", expected: geminiSuccessHeader},
+		{policy: SymlinksFollow, url: "/outside.gmi", expected: geminiSuccessHeader},
+		{policy: SymlinksFollow, url: "/outsidedir/secret.gmi", expected: geminiSuccessHeader},
+		{policy: SymlinksRefuse, url: "/page.gmi", expected: geminiSuccessHeader},
+		{policy: SymlinksRefuse, url: "/inside.gmi", expected: notFound},
+		{policy: SymlinksRefuse, url: "/outside.gmi", expected: notFound},
+		{policy: SymlinksRefuse, url: "/outsidedir/secret.gmi", expected: notFound},
+		{policy: SymlinksRefuse, url: "/missing.gmi", expected: notFound},
+		{policy: SymlinksWithinRoot, url: "/page.gmi", expected: geminiSuccessHeader},
+		{policy: SymlinksWithinRoot, url: "/inside.gmi", expected: geminiSuccessHeader},
+		{policy: SymlinksWithinRoot, url: "/outside.gmi", expected: notFound},
+		{policy: SymlinksWithinRoot, url: "/outsidedir/secret.gmi", expected: notFound},
+		{policy: SymlinksWithinRoot, url: "/", expected: geminiSuccessHeader},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.policy)+tt.url, func(t *testing.T) {
+			h := FileSystemHandlerWithOptions(Dir(root), FileServerOptions{Symlinks: tt.policy})
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Path: tt.url},
+			}
+			resp, err := Record(r, h)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expected.Code != resp.Header.Code || tt.expected.Meta != resp.Header.Meta {
+				t.Errorf("expected header %v, got %v", tt.expected, *resp.Header)
+			}
+		})
+	}
+}
+
+func TestFileSystemHandlerSymlinkListings(t *testing.T) {
+	outside := t.TempDir()
+	root := t.TempDir()
+	files := map[string]string{
+		filepath.Join(outside, "secret.gmi"):       "# Secret\n",
+		filepath.Join(outside, "header.gmi"):       "# Outside header\n",
+		filepath.Join(outside, "meta.toml"):        "lang = \"fr\"\n",
+		filepath.Join(root, "list", ".meta"):       "[listing]\nheader = \"header.gmi\"\nuseTitles = true\n",
+		filepath.Join(root, "list", "page.gmi"):    "# Page\n",
+		filepath.Join(root, "linkedmeta", "a.gmi"): "# A\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(root, "list", "header.gmi"):  filepath.Join(outside, "header.gmi"),
+		filepath.Join(root, "list", "inside.gmi"):  filepath.Join(root, "list", "page.gmi"),
+		filepath.Join(root, "list", "outside.gmi"): filepath.Join(outside, "secret.gmi"),
+		filepath.Join(root, "linkedmeta", ".meta"): filepath.Join(outside, "meta.toml"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, name); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	var tests = []struct {
+		policy         SymlinkPolicy
+		url            string
+		expectedHeader Header
+		expectedBody   string
+	}{
+		{
+			policy:         SymlinksFollow,
+			url:            "/list/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Outside header\n=> ../\n=> inside.gmi Page\n=> outside.gmi Secret\n=> page.gmi Page\n",
+		},
+		{
+			policy:         SymlinksWithinRoot,
+			url:            "/list/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /list/\n\n=> ../\n=> inside.gmi Page\n=> page.gmi Page\n",
+		},
+		{
+			policy:         SymlinksRefuse,
+			url:            "/list/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /list/\n\n=> ../\n=> page.gmi Page\n",
+		},
+		{
+			policy:         SymlinksFollow,
+			url:            "/linkedmeta/a.gmi",
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/gemini; charset=utf-8; lang=fr"},
+			expectedBody:   "# A\n",
+		},
+		{
+			policy:         SymlinksWithinRoot,
+			url:            "/linkedmeta/a.gmi",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# A\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.policy)+tt.url, func(t *testing.T) {
+			h := FileSystemHandlerWithOptions(Dir(root), FileServerOptions{Symlinks: tt.policy, MetadataFiles: true})
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Path: tt.url},
+			}
+			resp, err := Record(r, h)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedHeader.Code != resp.Header.Code || tt.expectedHeader.Meta != resp.Header.Meta {
+				t.Errorf("expected header %v, got %v", tt.expectedHeader, *resp.Header)
+			}
+			bdy, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if tt.expectedBody != string(bdy) {
+				t.Errorf("expected\n%v\nactual\n%v", tt.expectedBody, string(bdy))
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+// Package forms builds multi-step forms from a sequence of Gemini input prompts.
+//
+// Gemini has no forms, only prompts for a single line of input. A Form asks for each
+// of its fields in turn, and keeps the values entered so far between requests, either
+// in a session.Store keyed by the client certificate, or in a signed token in the path.
+package forms
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/log"
+	"github.com/a-h/gemini/mux"
+	"github.com/a-h/gemini/session"
+)
+
+// Field of a form.
+type Field struct {
+	// Name of the field, used as the key in the completed values.
+	Name string
+	// Prompt shown to the user.
+	Prompt string
+	// Sensitive fields, e.g. passwords, are prompted for with a status of 11.
+	Sensitive bool
+	// Validators check the input. If the input isn't valid, the user is prompted again.
+	Validators []gemini.InputValidator
+}
+
+func (f Field) prompt() gemini.InputPrompt {
+	return gemini.InputPrompt{
+		Prompt:     f.Prompt,
+		Sensitive:  f.Sensitive,
+		Validators: f.Validators,
+	}
+}
+
+// Values entered into a form, keyed by field name.
+type Values map[string]string
+
+// DefaultTTL is the time that a partially completed form is kept.
+const DefaultTTL = time.Hour
+
+// DefaultTokenVar is the name of the mux path variable that contains the state token.
+const DefaultTokenVar = "token"
+
+// Form is a sequence of fields that are prompted for in turn.
+type Form struct {
+	// Name of the form. Forms that share a Store must have different names.
+	Name   string
+	Fields []Field
+	// Complete is called when all of the fields have been entered. The request is the
+	// one that contained the value of the last field.
+	Complete func(w gemini.ResponseWriter, r *gemini.Request, values Values)
+
+	// Store keeps the values entered so far, keyed by the client certificate. Clients must
+	// present a certificate to use the form. If Store is nil, the values are kept in a
+	// token in the path, signed with Key.
+	Store session.Store
+	// Key used to sign the token. The token isn't encrypted, so forms that have sensitive
+	// fields require a Store.
+	Key []byte
+	// TokenVar is the mux path variable that contains the token, e.g. "token" in
+	// /signup/{token}. Defaults to DefaultTokenVar.
+	TokenVar string
+	// TTL is the time the user has to complete the form. Defaults to DefaultTTL.
+	TTL time.Duration
+
+	now func() time.Time
+}
+
+// state of a partially completed form.
+type state struct {
+	Step    int       `json:"s"`
+	Values  Values    `json:"v"`
+	Expires time.Time `json:"e"`
+}
+
+// ErrSensitiveFieldsRequireStore is returned when a form has sensitive fields, but no Store,
+// so their values would be written to the path, and to server and proxy logs.
+var ErrSensitiveFieldsRequireStore = errors.New("forms: sensitive fields require a Store")
+
+// ErrInvalidToken is returned when a state token has been modified, or has expired.
+var ErrInvalidToken = errors.New("forms: invalid token")
+
+func (f *Form) ttl() time.Duration {
+	if f.TTL > 0 {
+		return f.TTL
+	}
+	return DefaultTTL
+}
+
+func (f *Form) tokenVar() string {
+	if f.TokenVar != "" {
+		return f.TokenVar
+	}
+	return DefaultTokenVar
+}
+
+func (f *Form) time() time.Time {
+	if f.now != nil {
+		return f.now()
+	}
+	return time.Now()
+}
+
+// AddRoutes adds routes for the form to the Mux. With a Store, the form is served at
+// the pattern. Without a Store, the form is also served at pattern/{token}, so that the
+// state token can be passed in the path. AddRoutes panics if the form has sensitive fields,
+// but no Store.
+func (f *Form) AddRoutes(m *mux.Mux, pattern string) {
+	h := f.Handler()
+	m.AddRoute(pattern, h)
+	if f.Store == nil {
+		m.AddRoute(strings.TrimSuffix(pattern, "/")+"/{"+f.tokenVar()+"}", h)
+	}
+}
+
+// Handler returns a handler that prompts for each field in turn, and calls Complete
+// when all of the fields are valid. Handler panics if the form has sensitive fields, but
+// no Store.
+func (f *Form) Handler() gemini.Handler {
+	if err := f.validate(); err != nil {
+		panic(err)
+	}
+	return gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		if len(f.Fields) == 0 {
+			f.Complete(w, r, Values{})
+			return
+		}
+		if f.Store != nil {
+			f.serveWithStore(w, r)
+			return
+		}
+		f.serveWithToken(w, r)
+	})
+}
+
+func (f *Form) validate() error {
+	if f.Store != nil {
+		return nil
+	}
+	for _, field := range f.Fields {
+		if field.Sensitive {
+			return fmt.Errorf("%w: form %q, field %q", ErrSensitiveFieldsRequireStore, f.Name, field.Name)
+		}
+	}
+	return nil
+}
+
+// next validates the input for the current step, and returns the updated state. If the
+// input isn't valid, the user is prompted again, and ok is false.
+func (f *Form) next(w gemini.ResponseWriter, r *gemini.Request, s state) (updated state, ok bool) {
+	field := f.Fields[s.Step]
+	input, err := r.Input()
+	if errors.Is(err, gemini.ErrNoInput) {
+		prompt(w, field, field.Prompt)
+		return
+	}
+	if err != nil {
+		gemini.BadRequest(w, r)
+		return
+	}
+	if err = field.prompt().Validate(input); err != nil {
+		prompt(w, field, err.Error())
+		return
+	}
+	updated = state{
+		Step:    s.Step + 1,
+		Values:  Values{},
+		Expires: f.time().Add(f.ttl()),
+	}
+	for k, v := range s.Values {
+		updated.Values[k] = v
+	}
+	updated.Values[field.Name] = input
+	return updated, true
+}
+
+func (f *Form) serveWithStore(w gemini.ResponseWriter, r *gemini.Request) {
+	if r.Certificate.ID == "" {
+		w.SetHeader(gemini.CodeClientCertificateRequired, "client certificate required")
+		return
+	}
+	id := f.Name + ":" + r.Certificate.ID
+	s := state{Values: Values{}}
+	// Visiting the form without input starts again.
+	if r.HasInput() {
+		stored, err := f.Store.Get(id)
+		if err != nil && !errors.Is(err, session.ErrNotFound) {
+			log.Error("forms: failed to load state", err, log.String("url", r.URL.String()))
+			w.SetHeader(gemini.CodeTemporaryFailure, "temporary failure")
+			return
+		}
+		if err == nil && !f.time().After(stored.Expires) {
+			s = fromSession(stored)
+		}
+	}
+	if s.Step >= len(f.Fields) {
+		s = state{Values: Values{}}
+	}
+	s, ok := f.next(w, r, s)
+	if !ok {
+		return
+	}
+	if s.Step == len(f.Fields) {
+		if err := f.Store.Delete(id); err != nil && !errors.Is(err, session.ErrNotFound) {
+			log.Error("forms: failed to delete state", err, log.String("url", r.URL.String()))
+		}
+		f.Complete(w, r, s.Values)
+		return
+	}
+	if err := f.Store.Put(toSession(id, s)); err != nil {
+		log.Error("forms: failed to save state", err, log.String("url", r.URL.String()))
+		w.SetHeader(gemini.CodeTemporaryFailure, "temporary failure")
+		return
+	}
+	// The client sends the next input to the same URL.
+	next := f.Fields[s.Step]
+	prompt(w, next, next.Prompt)
+}
+
+func prompt(w gemini.ResponseWriter, field Field, meta string) {
+	if field.Sensitive {
+		w.SetHeader(gemini.CodeInputSensitive, meta)
+		return
+	}
+	w.SetHeader(gemini.CodeInput, meta)
+}
+
+// Session keys. Values are stored with a prefix, so that a field can't overwrite the step.
+const (
+	stepKey     = "step"
+	valuePrefix = "value:"
+)
+
+func toSession(id string, s state) *session.Session {
+	ss := session.New(id, s.Expires)
+	for k, v := range s.Values {
+		ss.Set(valuePrefix+k, v)
+	}
+	ss.Set(stepKey, fmt.Sprint(s.Step))
+	return ss
+}
+
+func fromSession(ss *session.Session) (s state) {
+	s.Values = Values{}
+	for k, v := range ss.Values() {
+		if strings.HasPrefix(k, valuePrefix) {
+			s.Values[strings.TrimPrefix(k, valuePrefix)] = v
+		}
+	}
+	if step, ok := ss.Get(stepKey); ok {
+		fmt.Sscan(step, &s.Step)
+	}
+	s.Expires = ss.Expires
+	return
+}
+
+func (f *Form) serveWithToken(w gemini.ResponseWriter, r *gemini.Request) {
+	base := r.URL.Path
+	s := state{Values: Values{}}
+	if mr, ok := mux.GetMatchedRoute(r.Context); ok {
+		if t, ok := mr.Var(f.tokenVar()); ok {
+			var err error
+			if s, err = f.decode(t); err != nil {
+				// Start again, rather than showing an error.
+				w.SetHeader(gemini.CodeRedirect, path.Dir(strings.TrimSuffix(base, "/")))
+				return
+			}
+			base = path.Dir(strings.TrimSuffix(base, "/"))
+		}
+	}
+	if s.Step >= len(f.Fields) {
+		gemini.BadRequest(w, r)
+		return
+	}
+	s, ok := f.next(w, r, s)
+	if !ok {
+		return
+	}
+	if s.Step == len(f.Fields) {
+		f.Complete(w, r, s.Values)
+		return
+	}
+	t, err := f.encode(s)
+	if err != nil {
+		log.Error("forms: failed to create token", err, log.String("url", r.URL.String()))
+		w.SetHeader(gemini.CodeTemporaryFailure, "temporary failure")
+		return
+	}
+	w.SetHeader(gemini.CodeRedirect, strings.TrimSuffix(base, "/")+"/"+t)
+}
+
+func (f *Form) sign(payload string) string {
+	mac := hmac.New(sha256.New, f.Key)
+	mac.Write([]byte(f.Name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (f *Form) encode(s state) (t string, err error) {
+	if len(f.Key) == 0 {
+		err = errors.New("forms: a Key or Store is required")
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + f.sign(payload), nil
+}
+
+func (f *Form) decode(t string) (s state, err error) {
+	parts := strings.Split(t, ".")
+	if len(f.Key) == 0 || len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(f.sign(parts[0]))) {
+		err = ErrInvalidToken
+		return
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		err = ErrInvalidToken
+		return
+	}
+	if err = json.Unmarshal(data, &s); err != nil {
+		err = ErrInvalidToken
+		return
+	}
+	if f.time().After(s.Expires) {
+		err = ErrInvalidToken
+		return
+	}
+	if s.Values == nil {
+		s.Values = Values{}
+	}
+	return
+}
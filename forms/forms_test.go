@@ -0,0 +1,204 @@
+package forms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/mux"
+	"github.com/a-h/gemini/session"
+)
+
+type step struct {
+	path           string
+	input          string
+	expectedCode   gemini.Code
+	expectedMeta   string
+	expectedBody   string
+	followRedirect bool
+}
+
+func newForm() *Form {
+	return &Form{
+		Name: "signup",
+		Fields: []Field{
+			{Name: "name", Prompt: "Name", Validators: []gemini.InputValidator{gemini.MinLength(2)}},
+			{Name: "password", Prompt: "Password", Sensitive: true},
+		},
+		Complete: func(w gemini.ResponseWriter, r *gemini.Request, values Values) {
+			fmt.Fprintf(w, "%s:%s", values["name"], values["password"])
+		},
+	}
+}
+
+func run(t *testing.T, m *mux.Mux, certID string, steps []step) {
+	var redirect string
+	for i, s := range steps {
+		p := s.path
+		if s.followRedirect {
+			p = redirect
+		}
+		r := &gemini.Request{
+			Context:     context.Background(),
+			URL:         &url.URL{Scheme: "gemini", Host: "example.com", Path: p, RawQuery: url.PathEscape(s.input)},
+			Certificate: gemini.Certificate{ID: certID},
+		}
+		resp, err := gemini.Record(r, m)
+		if err != nil {
+			t.Fatalf("step %d: failed to record request: %v", i, err)
+		}
+		if resp.Header.Code != s.expectedCode {
+			t.Fatalf("step %d: expected code %v, got %v %q", i, s.expectedCode, resp.Header.Code, resp.Header.Meta)
+		}
+		if s.expectedMeta != "" && resp.Header.Meta != s.expectedMeta {
+			t.Errorf("step %d: expected meta %q, got %q", i, s.expectedMeta, resp.Header.Meta)
+		}
+		if resp.Header.Code == gemini.CodeRedirect {
+			redirect = resp.Header.Meta
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("step %d: failed to read body: %v", i, err)
+		}
+		if string(body) != s.expectedBody {
+			t.Errorf("step %d: expected body %q, got %q", i, s.expectedBody, string(body))
+		}
+	}
+}
+
+func TestFormWithStore(t *testing.T) {
+	f := newForm()
+	f.Store = session.NewMemoryStore()
+	m := mux.NewMux()
+	f.AddRoutes(m, "/signup")
+
+	run(t, m, "", []step{
+		{path: "/signup", expectedCode: gemini.CodeClientCertificateRequired},
+	})
+	run(t, m, "cert1", []step{
+		{path: "/signup", expectedCode: gemini.CodeInput, expectedMeta: "Name"},
+		{path: "/signup", input: "a", expectedCode: gemini.CodeInput, expectedMeta: "enter at least 2 characters"},
+		{path: "/signup", input: "alice", expectedCode: gemini.CodeInputSensitive, expectedMeta: "Password"},
+		{path: "/signup", input: "secret", expectedCode: gemini.CodeSuccess, expectedBody: "alice:secret"},
+		// The state is removed once the form is complete.
+		{path: "/signup", input: "bob", expectedCode: gemini.CodeInputSensitive, expectedMeta: "Password"},
+		// Visiting the form without input starts again.
+		{path: "/signup", expectedCode: gemini.CodeInput, expectedMeta: "Name"},
+	})
+}
+
+func TestFormWithStoreFieldNames(t *testing.T) {
+	f := &Form{
+		Name: "steps",
+		Fields: []Field{
+			{Name: "_step", Prompt: "First"},
+			{Name: "step", Prompt: "Second"},
+			{Name: "last", Prompt: "Third"},
+		},
+		Complete: func(w gemini.ResponseWriter, r *gemini.Request, values Values) {
+			fmt.Fprintf(w, "%s:%s:%s", values["_step"], values["step"], values["last"])
+		},
+		Store: session.NewMemoryStore(),
+	}
+	m := mux.NewMux()
+	f.AddRoutes(m, "/steps")
+	run(t, m, "cert1", []step{
+		{path: "/steps", input: "5", expectedCode: gemini.CodeInput, expectedMeta: "Second"},
+		{path: "/steps", input: "0", expectedCode: gemini.CodeInput, expectedMeta: "Third"},
+		{path: "/steps", input: "c", expectedCode: gemini.CodeSuccess, expectedBody: "5:0:c"},
+	})
+}
+
+func TestFormWithToken(t *testing.T) {
+	f := newForm()
+	// Sensitive fields require a Store.
+	f.Fields[1].Sensitive = false
+	f.Key = []byte("secret key")
+	m := mux.NewMux()
+	f.AddRoutes(m, "/signup")
+
+	run(t, m, "", []step{
+		{path: "/signup", expectedCode: gemini.CodeInput, expectedMeta: "Name"},
+		{path: "/signup", input: "alice", expectedCode: gemini.CodeRedirect},
+		{followRedirect: true, expectedCode: gemini.CodeInput, expectedMeta: "Password"},
+		{followRedirect: true, input: "secret", expectedCode: gemini.CodeSuccess, expectedBody: "alice:secret"},
+		// Modified tokens start again.
+		{path: "/signup/abc.def", input: "secret", expectedCode: gemini.CodeRedirect, expectedMeta: "/signup"},
+	})
+}
+
+func TestSensitiveFieldsRequireStore(t *testing.T) {
+	var tests = []struct {
+		name          string
+		store         session.Store
+		expectedPanic bool
+	}{
+		{name: "sensitive fields without a store are rejected", expectedPanic: true},
+		{name: "sensitive fields with a store are allowed", store: session.NewMemoryStore()},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for _, add := range []func(f *Form){
+				func(f *Form) { f.Handler() },
+				func(f *Form) { f.AddRoutes(mux.NewMux(), "/signup") },
+			} {
+				func() {
+					defer func() {
+						r := recover()
+						if panicked := r != nil; panicked != tt.expectedPanic {
+							t.Errorf("expected panic %v, got %v", tt.expectedPanic, r)
+						}
+						if err, ok := r.(error); ok && !errors.Is(err, ErrSensitiveFieldsRequireStore) {
+							t.Errorf("expected ErrSensitiveFieldsRequireStore, got %v", err)
+						}
+					}()
+					f := newForm()
+					f.Key = []byte("secret key")
+					f.Store = tt.store
+					add(f)
+				}()
+			}
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	f := newForm()
+	f.Key = []byte("secret key")
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	tok, err := f.encode(state{Step: 1, Values: Values{"name": "alice"}, Expires: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("failed to encode token: %v", err)
+	}
+	s, err := f.decode(tok)
+	if err != nil {
+		t.Fatalf("failed to decode token: %v", err)
+	}
+	if s.Step != 1 || s.Values["name"] != "alice" {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	other := newForm()
+	other.Name = "other"
+	other.Key = f.Key
+	if _, err = other.decode(tok); err != ErrInvalidToken {
+		t.Errorf("expected tokens to be specific to a form, got %v", err)
+	}
+	parts := strings.Split(tok, ".")
+	if _, err = f.decode(parts[0] + "x." + parts[1]); err != ErrInvalidToken {
+		t.Errorf("expected modified token to be rejected, got %v", err)
+	}
+	now = now.Add(time.Hour)
+	if _, err = f.decode(tok); err != ErrInvalidToken {
+		t.Errorf("expected expired token to be rejected, got %v", err)
+	}
+}
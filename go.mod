@@ -1,5 +1,5 @@
 module github.com/a-h/gemini
 
-go 1.14
+go 1.16
 
 require github.com/BurntSushi/toml v1.3.2
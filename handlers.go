@@ -61,7 +61,8 @@ func StripPrefixHandler(prefix string, h Handler) Handler {
 // RequireCertificateHandler returns a handler that enforces authentication on h.
 // authoriser can be set to limit which users can access h. If authoriser
 // is nil, authoriser is set to AuthoriserAllowAll which allows any authenticated
-// user to access the handler.
+// user to access the handler. Certificates that have expired, or aren't yet valid,
+// receive a 62 (certificate not valid).
 func RequireCertificateHandler(h Handler, authoriser func(certID, certKey string) bool) Handler {
 	if authoriser == nil {
 		authoriser = AuthoriserAllowAll
@@ -71,6 +72,10 @@ func RequireCertificateHandler(h Handler, authoriser func(certID, certKey string
 			w.SetHeader(CodeClientCertificateRequired, "client certificate required")
 			return
 		}
+		if r.Certificate.Error != "" {
+			w.SetHeader(CodeClientCertificateNotValid, r.Certificate.Error)
+			return
+		}
 		if !authoriser(r.Certificate.ID, r.Certificate.Key) {
 			w.SetHeader(CodeClientCertificateNotAuthorised, "not authorised")
 			return
@@ -82,6 +87,7 @@ func RequireCertificateHandler(h Handler, authoriser func(certID, certKey string
 // RequireInputHandler returns a handler that enforces all incoming requests have a populated
 // querystring.
 // `prompt` is returned as response META if input is not provided.
+// Use InputPrompt to validate the input, or prompt for sensitive input.
 func RequireInputHandler(h Handler, prompt string) Handler {
 	return HandlerFunc(func(w ResponseWriter, r *Request) {
 		if r.URL.RawQuery == "" {
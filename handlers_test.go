@@ -0,0 +1,57 @@
+package gemini
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestRequireCertificateHandler(t *testing.T) {
+	h := RequireCertificateHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Write([]byte("OK"))
+	}), func(certID, certKey string) bool {
+		return certID != "denied"
+	})
+	var tests = []struct {
+		name         string
+		certificate  Certificate
+		expectedCode Code
+	}{
+		{
+			name:         "requests without a certificate receive a 60",
+			expectedCode: CodeClientCertificateRequired,
+		},
+		{
+			name:         "expired certificates receive a 62",
+			certificate:  Certificate{ID: "allowed", Error: "certificate expired"},
+			expectedCode: CodeClientCertificateNotValid,
+		},
+		{
+			name:         "unauthorised certificates receive a 61",
+			certificate:  Certificate{ID: "denied"},
+			expectedCode: CodeClientCertificateNotAuthorised,
+		},
+		{
+			name:         "authorised certificates are allowed",
+			certificate:  Certificate{ID: "allowed"},
+			expectedCode: CodeSuccess,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Request{
+				Context:     context.Background(),
+				URL:         &url.URL{Scheme: "gemini", Host: "example.com", Path: "/"},
+				Certificate: tt.certificate,
+			}
+			resp, err := Record(r, h)
+			if err != nil {
+				t.Fatalf("failed to record request: %v", err)
+			}
+			if resp.Header.Code != tt.expectedCode {
+				t.Errorf("expected code %v, got %v", tt.expectedCode, resp.Header.Code)
+			}
+		})
+	}
+}
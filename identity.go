@@ -0,0 +1,226 @@
+package gemini
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-h/gemini/cert"
+)
+
+// Identity is a client certificate presented to Gemini servers when the
+// requested URL starts with Scope.
+type Identity struct {
+	// Name of the identity, used to select it from the command line.
+	Name string
+	// Scope is the URL prefix that the identity is used for, e.g. gemini://example.com/app/
+	// An empty scope matches every URL.
+	Scope       string
+	Certificate tls.Certificate
+}
+
+// IdentityStore holds the client identities available to a Client and selects the
+// identity to use for a given URL.
+type IdentityStore struct {
+	// Store that identities are persisted to. If nil, identities are only held in memory.
+	Store      cert.Store
+	m          sync.RWMutex
+	identities map[string]Identity
+}
+
+// NewIdentityStore creates an in-memory store of client identities.
+func NewIdentityStore() *IdentityStore {
+	return &IdentityStore{
+		identities: make(map[string]Identity),
+	}
+}
+
+// ErrIdentityExists is returned when an identity can't be generated because an identity
+// with the same name already exists.
+var ErrIdentityExists = errors.New("gemini: identity already exists")
+
+// scopeMetadataKey is the cert.Entry metadata key used to store the scope of an identity.
+const scopeMetadataKey = "scope"
+
+// LoadIdentityStore loads the identities persisted in dir. The directory is
+// created if it does not exist.
+func LoadIdentityStore(dir string) (s *IdentityStore, err error) {
+	store, err := cert.NewFileStore(dir)
+	if err != nil {
+		return
+	}
+	return LoadIdentities(store)
+}
+
+// LoadIdentities loads the identities persisted in the certificate store. New identities
+// are written to the store.
+func LoadIdentities(store cert.Store) (s *IdentityStore, err error) {
+	s = NewIdentityStore()
+	s.Store = store
+	names, err := store.List()
+	if err != nil {
+		err = fmt.Errorf("gemini: failed to list identities: %w", err)
+		return
+	}
+	for _, name := range names {
+		e, err := store.Get(name)
+		if err != nil {
+			return s, fmt.Errorf("gemini: failed to load identity %q: %w", name, err)
+		}
+		keyPair, err := e.KeyPair()
+		if err != nil {
+			return s, fmt.Errorf("gemini: failed to load identity %q: %w", name, err)
+		}
+		s.set(Identity{
+			Name:        name,
+			Scope:       e.Metadata[scopeMetadataKey],
+			Certificate: keyPair,
+		})
+	}
+	return
+}
+
+func (s *IdentityStore) set(id Identity) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.identities[id.Name] = id
+}
+
+func (s *IdentityStore) exists(name string) (ok bool, err error) {
+	if _, ok = s.Get(name); ok || s.Store == nil {
+		return
+	}
+	_, err = s.Store.Get(name)
+	if errors.Is(err, cert.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("gemini: failed to check for identity %q: %w", name, err)
+	}
+	return true, nil
+}
+
+// Add an identity to the store, replacing any existing identity with the same name.
+// If the IdentityStore has a Store, the certificate, key and scope are written to it.
+func (s *IdentityStore) Add(id Identity) (err error) {
+	if s.Store != nil {
+		e, err := cert.NewEntry(id.Certificate)
+		if err != nil {
+			return fmt.Errorf("gemini: failed to encode identity %q: %w", id.Name, err)
+		}
+		e.Metadata = map[string]string{scopeMetadataKey: id.Scope}
+		if err = s.Store.Put(id.Name, e); err != nil {
+			return fmt.Errorf("gemini: failed to save identity %q: %w", id.Name, err)
+		}
+	}
+	s.set(id)
+	return
+}
+
+// Remove an identity from the IdentityStore, and from its Store, if set.
+func (s *IdentityStore) Remove(name string) (err error) {
+	s.m.Lock()
+	delete(s.identities, name)
+	s.m.Unlock()
+	if s.Store == nil {
+		return
+	}
+	if err = s.Store.Delete(name); err != nil && !errors.Is(err, cert.ErrNotFound) {
+		return fmt.Errorf("gemini: failed to remove identity %q: %w", name, err)
+	}
+	return nil
+}
+
+// Get an identity by name.
+func (s *IdentityStore) Get(name string) (id Identity, ok bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	id, ok = s.identities[name]
+	return
+}
+
+// List the identities in the store, ordered by name.
+func (s *IdentityStore) List() (ids []Identity) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for _, id := range s.identities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Name < ids[j].Name })
+	return
+}
+
+// Match returns the identity with the longest scope that prefixes the URL. If two
+// identities have the same scope, the one with the lowest name is used, so that the
+// result is deterministic. The scheme and host of the URL are lowercased, and an empty
+// path is treated as "/", so gemini://Example.com matches the gemini://example.com/ scope.
+func (s *IdentityStore) Match(u *url.URL) (id Identity, ok bool) {
+	us := normalizeURL(u).String()
+	for _, candidate := range s.List() {
+		if !strings.HasPrefix(us, candidate.Scope) {
+			continue
+		}
+		if !ok || len(candidate.Scope) > len(id.Scope) {
+			id = candidate
+			ok = true
+		}
+	}
+	return
+}
+
+// Generate a new self-signed identity, scoped to the given URL prefix, and add it to the store.
+// If an identity with the same name exists, ErrIdentityExists is returned, so that existing
+// keys aren't lost. To replace an identity, Remove it first.
+func (s *IdentityStore) Generate(name, scope string, duration time.Duration) (id Identity, err error) {
+	exists, err := s.exists(name)
+	if err != nil {
+		return
+	}
+	if exists {
+		err = fmt.Errorf("%w: %q", ErrIdentityExists, name)
+		return
+	}
+	certPEM, keyPEM, err := cert.GenerateClient(cert.Options{
+		CommonName: name,
+		Duration:   duration,
+	})
+	if err != nil {
+		return
+	}
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		err = fmt.Errorf("gemini: failed to load generated identity: %w", err)
+		return
+	}
+	id = Identity{
+		Name:        name,
+		Scope:       scope,
+		Certificate: keyPair,
+	}
+	err = s.Add(id)
+	return
+}
+
+// ScopeForURL returns the scope used for identities generated in response to a
+// request to u, i.e. the scheme and host of the URL.
+func ScopeForURL(u *url.URL) string {
+	n := normalizeURL(u)
+	return (&url.URL{Scheme: n.Scheme, Host: n.Host, Path: "/"}).String()
+}
+
+// normalizeURL lowercases the scheme and host of u, and sets an empty path to "/".
+func normalizeURL(u *url.URL) *url.URL {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if n.Path == "" && n.Opaque == "" {
+		n.Path = "/"
+		n.RawPath = ""
+	}
+	return &n
+}
@@ -0,0 +1,195 @@
+package gemini
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIdentityStoreMatch(t *testing.T) {
+	var tests = []struct {
+		name         string
+		scopes       map[string]string
+		url          string
+		expectedName string
+		expectedOK   bool
+	}{
+		{
+			name:       "no identities results in no match",
+			scopes:     map[string]string{},
+			url:        "gemini://example.com/",
+			expectedOK: false,
+		},
+		{
+			name: "identities for other hosts are not matched",
+			scopes: map[string]string{
+				"a": "gemini://a.example.com/",
+			},
+			url:        "gemini://b.example.com/",
+			expectedOK: false,
+		},
+		{
+			name: "the longest matching prefix is used",
+			scopes: map[string]string{
+				"host":  "gemini://example.com/",
+				"app":   "gemini://example.com/app/",
+				"admin": "gemini://example.com/app/admin/",
+				"other": "gemini://example.com/other/",
+			},
+			url:          "gemini://example.com/app/settings",
+			expectedName: "app",
+			expectedOK:   true,
+		},
+		{
+			name: "empty scopes match everything",
+			scopes: map[string]string{
+				"default": "",
+			},
+			url:          "gemini://example.com/app/settings",
+			expectedName: "default",
+			expectedOK:   true,
+		},
+		{
+			name: "URLs without a path match the host scope",
+			scopes: map[string]string{
+				"host": "gemini://example.com/",
+			},
+			url:          "gemini://example.com",
+			expectedName: "host",
+			expectedOK:   true,
+		},
+		{
+			name: "the host is matched case insensitively",
+			scopes: map[string]string{
+				"host": "gemini://example.com/",
+			},
+			url:          "gemini://Example.COM/app",
+			expectedName: "host",
+			expectedOK:   true,
+		},
+		{
+			name: "identities with the same scope are selected by name",
+			scopes: map[string]string{
+				"b": "gemini://example.com/",
+				"a": "gemini://example.com/",
+				"c": "gemini://example.com/",
+			},
+			url:          "gemini://example.com/",
+			expectedName: "a",
+			expectedOK:   true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewIdentityStore()
+			for name, scope := range tt.scopes {
+				if err := s.Add(Identity{Name: name, Scope: scope}); err != nil {
+					t.Fatalf("unexpected error adding identity: %v", err)
+				}
+			}
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("failed to parse URL %q: %v", tt.url, err)
+			}
+			// Run multiple times to ensure that map ordering doesn't change the result.
+			for i := 0; i < 10; i++ {
+				id, ok := s.Match(u)
+				if ok != tt.expectedOK {
+					t.Fatalf("expected ok %v, got %v", tt.expectedOK, ok)
+				}
+				if id.Name != tt.expectedName {
+					t.Fatalf("expected identity %q, got %q", tt.expectedName, id.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentityStorePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_identities")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := LoadIdentityStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	generated, err := s.Generate("user/name", "gemini://example.com/", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate identity: %v", err)
+	}
+
+	loaded, err := LoadIdentityStore(dir)
+	if err != nil {
+		t.Fatalf("failed to load store: %v", err)
+	}
+	id, ok := loaded.Get("user/name")
+	if !ok {
+		t.Fatalf("expected to load generated identity, got %v", loaded.List())
+	}
+	if id.Scope != generated.Scope {
+		t.Errorf("expected scope %q, got %q", generated.Scope, id.Scope)
+	}
+	if string(id.Certificate.Certificate[0]) != string(generated.Certificate.Certificate[0]) {
+		t.Errorf("loaded certificate does not match the generated certificate")
+	}
+
+	if err = loaded.Remove("user/name"); err != nil {
+		t.Fatalf("failed to remove identity: %v", err)
+	}
+	reloaded, err := LoadIdentityStore(dir)
+	if err != nil {
+		t.Fatalf("failed to reload store: %v", err)
+	}
+	if len(reloaded.List()) != 0 {
+		t.Errorf("expected no identities after removal, got %d", len(reloaded.List()))
+	}
+}
+
+func TestIdentityStoreCreateForURLWithoutPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_identities")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, err := url.Parse("gemini://example.com")
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+	// Run the command's create step twice: reuse a matching identity, or generate one.
+	var certificates [][]byte
+	for i := 0; i < 2; i++ {
+		s, err := LoadIdentityStore(dir)
+		if err != nil {
+			t.Fatalf("failed to load store: %v", err)
+		}
+		id, ok := s.Match(u)
+		if !ok {
+			if id, err = s.Generate(u.Hostname(), ScopeForURL(u), time.Hour); err != nil {
+				t.Fatalf("run %d: failed to generate identity: %v", i, err)
+			}
+		}
+		certificates = append(certificates, id.Certificate.Certificate[0])
+	}
+	if string(certificates[0]) != string(certificates[1]) {
+		t.Errorf("expected the identity created by the first run to be reused")
+	}
+
+	s, err := LoadIdentityStore(dir)
+	if err != nil {
+		t.Fatalf("failed to load store: %v", err)
+	}
+	if _, err = s.Generate("example.com", "gemini://example.com/", time.Hour); !errors.Is(err, ErrIdentityExists) {
+		t.Errorf("expected ErrIdentityExists generating an existing identity, got %v", err)
+	}
+	if id, _ := s.Get("example.com"); string(id.Certificate.Certificate[0]) != string(certificates[0]) {
+		t.Errorf("expected the existing identity to be kept")
+	}
+}
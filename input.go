@@ -0,0 +1,124 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"unicode/utf8"
+)
+
+// ErrNoInput is returned by Request.Input when the request doesn't have a query.
+var ErrNoInput = errors.New("gemini: no input")
+
+// Input returns the user input sent in response to a 10 or 11 prompt. Gemini clients send
+// the whole query as the percent-encoded input, so it's decoded without treating + as a
+// space, or splitting it into key/value pairs. ErrNoInput is returned if the query is empty.
+func (r *Request) Input() (input string, err error) {
+	if r.URL == nil || r.URL.RawQuery == "" {
+		err = ErrNoInput
+		return
+	}
+	input, err = url.PathUnescape(r.URL.RawQuery)
+	if err != nil {
+		err = fmt.Errorf("gemini: invalid input: %w", err)
+	}
+	return
+}
+
+// HasInput returns true if the request has a query.
+func (r *Request) HasInput() bool {
+	return r.URL != nil && r.URL.RawQuery != ""
+}
+
+// InputValidator checks user input. The error message is shown to the user when
+// they're prompted again.
+type InputValidator func(input string) error
+
+// MinLength returns an InputValidator that requires at least n characters.
+func MinLength(n int) InputValidator {
+	return func(input string) error {
+		if utf8.RuneCountInString(input) < n {
+			return fmt.Errorf("enter at least %d characters", n)
+		}
+		return nil
+	}
+}
+
+// MaxLength returns an InputValidator that allows at most n characters.
+func MaxLength(n int) InputValidator {
+	return func(input string) error {
+		if utf8.RuneCountInString(input) > n {
+			return fmt.Errorf("enter at most %d characters", n)
+		}
+		return nil
+	}
+}
+
+// MatchPattern returns an InputValidator that requires the input to match the regular
+// expression. The message is shown to the user if it doesn't, e.g. "use lower case letters".
+func MatchPattern(re *regexp.Regexp, message string) InputValidator {
+	return func(input string) error {
+		if !re.MatchString(input) {
+			return errors.New(message)
+		}
+		return nil
+	}
+}
+
+// InputPrompt asks the user for input.
+type InputPrompt struct {
+	// Prompt shown to the user.
+	Prompt string
+	// Sensitive input, e.g. a password, is prompted for with a status of 11, so that
+	// clients don't display it while it's entered.
+	Sensitive bool
+	// Validators check the input. If the input isn't valid, the user is prompted again
+	// with the validation message.
+	Validators []InputValidator
+}
+
+func (p InputPrompt) code() Code {
+	if p.Sensitive {
+		return CodeInputSensitive
+	}
+	return CodeInput
+}
+
+// Validate the input, returning the first error.
+func (p InputPrompt) Validate(input string) error {
+	for _, v := range p.Validators {
+		if err := v(input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns a handler that prompts for input, and passes requests with valid input to h.
+// Handlers can read the input with Request.Input. Requests with input that isn't correctly
+// percent-encoded receive a 59 (bad request).
+func (p InputPrompt) Handler(h Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		input, err := r.Input()
+		if errors.Is(err, ErrNoInput) {
+			w.SetHeader(p.code(), p.Prompt)
+			return
+		}
+		if err != nil {
+			BadRequest(w, r)
+			return
+		}
+		if err = p.Validate(input); err != nil {
+			w.SetHeader(p.code(), err.Error())
+			return
+		}
+		h.ServeGemini(w, r)
+	})
+}
+
+// RequireSensitiveInputHandler returns a handler that prompts for sensitive input, e.g.
+// a password, with a status of 11. Requests with input are passed to h.
+func RequireSensitiveInputHandler(h Handler, prompt string) Handler {
+	return InputPrompt{Prompt: prompt, Sensitive: true}.Handler(h)
+}
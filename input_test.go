@@ -0,0 +1,166 @@
+package gemini
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestRequestInput(t *testing.T) {
+	var tests = []struct {
+		rawQuery      string
+		expected      string
+		expectedError bool
+	}{
+		{rawQuery: "", expectedError: true},
+		{rawQuery: "hello%20world", expected: "hello world"},
+		{rawQuery: "a+b", expected: "a+b"},
+		{rawQuery: "a=b&c=d", expected: "a=b&c=d"},
+		{rawQuery: "%E2%9C%93", expected: "✓"},
+		{rawQuery: "bad%zz", expectedError: true},
+	}
+	for _, tt := range tests {
+		r := &Request{URL: &url.URL{Path: "/", RawQuery: tt.rawQuery}}
+		actual, err := r.Input()
+		if (err != nil) != tt.expectedError {
+			t.Errorf("%q: expected error %v, got %v", tt.rawQuery, tt.expectedError, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.rawQuery, tt.expected, actual)
+		}
+	}
+}
+
+func TestInputPrompt(t *testing.T) {
+	prompt := InputPrompt{
+		Prompt: "Username",
+		Validators: []InputValidator{
+			MinLength(2),
+			MaxLength(5),
+			MatchPattern(regexp.MustCompile(`^[a-z]+$`), "use lower case letters"),
+		},
+	}
+	var tests = []struct {
+		name           string
+		prompt         InputPrompt
+		rawQuery       string
+		expectedHeader Header
+		expectedBody   string
+	}{
+		{
+			name:           "requests without input are prompted",
+			prompt:         prompt,
+			expectedHeader: Header{Code: CodeInput, Meta: "Username"},
+		},
+		{
+			name:           "sensitive input is prompted with an 11",
+			prompt:         InputPrompt{Prompt: "Password", Sensitive: true},
+			expectedHeader: Header{Code: CodeInputSensitive, Meta: "Password"},
+		},
+		{
+			name:           "invalid input is prompted again with the validation message",
+			prompt:         prompt,
+			rawQuery:       "a",
+			expectedHeader: Header{Code: CodeInput, Meta: "enter at least 2 characters"},
+		},
+		{
+			name:           "input is validated in characters, not bytes",
+			prompt:         prompt,
+			rawQuery:       "%C3%A9%C3%A9%C3%A9",
+			expectedHeader: Header{Code: CodeInput, Meta: "use lower case letters"},
+		},
+		{
+			name:           "long input is rejected",
+			prompt:         prompt,
+			rawQuery:       "abcdef",
+			expectedHeader: Header{Code: CodeInput, Meta: "enter at most 5 characters"},
+		},
+		{
+			name:           "badly encoded input is a bad request",
+			prompt:         prompt,
+			rawQuery:       "%zz",
+			expectedHeader: Header{Code: CodeBadRequest, Meta: "bad request"},
+		},
+		{
+			name:           "valid input is passed to the handler",
+			prompt:         prompt,
+			rawQuery:       "abc",
+			expectedHeader: Header{Code: CodeSuccess, Meta: DefaultMIMEType},
+			expectedBody:   "abc",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.prompt.Handler(HandlerFunc(func(w ResponseWriter, r *Request) {
+				input, _ := r.Input()
+				w.Write([]byte(input))
+			}))
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Scheme: "gemini", Host: "example.com", Path: "/", RawQuery: tt.rawQuery},
+			}
+			resp, err := Record(r, h)
+			if err != nil {
+				t.Fatalf("failed to record request: %v", err)
+			}
+			if resp.Header.Code != tt.expectedHeader.Code || resp.Header.Meta != tt.expectedHeader.Meta {
+				t.Errorf("expected header %v, got %v", tt.expectedHeader, *resp.Header)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			if string(body) != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestRequireInputHandler(t *testing.T) {
+	h := RequireInputHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}), "Search")
+	var tests = []struct {
+		rawQuery       string
+		expectedHeader Header
+		expectedBody   string
+	}{
+		{
+			expectedHeader: Header{Code: CodeInput, Meta: "Search"},
+		},
+		{
+			rawQuery:       "gemini%20protocol",
+			expectedHeader: Header{Code: CodeSuccess, Meta: DefaultMIMEType},
+			expectedBody:   "gemini%20protocol",
+		},
+		{
+			rawQuery:       "%zz",
+			expectedHeader: Header{Code: CodeSuccess, Meta: DefaultMIMEType},
+			expectedBody:   "%zz",
+		},
+	}
+	for _, tt := range tests {
+		r := &Request{
+			Context: context.Background(),
+			URL:     &url.URL{Scheme: "gemini", Host: "example.com", Path: "/", RawQuery: tt.rawQuery},
+		}
+		resp, err := Record(r, h)
+		if err != nil {
+			t.Fatalf("failed to record request: %v", err)
+		}
+		if resp.Header.Code != tt.expectedHeader.Code || resp.Header.Meta != tt.expectedHeader.Meta {
+			t.Errorf("%q: expected header %v, got %v", tt.rawQuery, tt.expectedHeader, *resp.Header)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		if string(body) != tt.expectedBody {
+			t.Errorf("%q: expected body %q, got %q", tt.rawQuery, tt.expectedBody, string(body))
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package atomicfile writes files so that readers see either the previous or the new
+// content, never a partially written file.
+package atomicfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Write data to the named file. The data is written to a temporary file in the same
+// directory, synced to disk, and renamed over the file.
+func Write(name string, data []byte, perm os.FileMode) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return fmt.Errorf("atomicfile: failed to create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err = f.Chmod(perm); err != nil {
+		return fmt.Errorf("atomicfile: failed to set file permissions: %w", err)
+	}
+	if _, err = f.Write(data); err != nil {
+		return fmt.Errorf("atomicfile: failed to write file: %w", err)
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("atomicfile: failed to sync file: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("atomicfile: failed to close file: %w", err)
+	}
+	if err = os.Rename(f.Name(), name); err != nil {
+		return fmt.Errorf("atomicfile: failed to rename file: %w", err)
+	}
+	return nil
+}
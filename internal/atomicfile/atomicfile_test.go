@@ -0,0 +1,48 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_atomicfile")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file.txt")
+
+	for _, content := range []string{"first", "second"} {
+		if err = Write(name, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		actual, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatalf("failed to read file: %v", err)
+		}
+		if string(actual) != content {
+			t.Errorf("expected %q, got %q", content, actual)
+		}
+	}
+	stat, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("failed to stat file: %v", err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		t.Errorf("expected permissions 0600, got %v", stat.Mode().Perm())
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected temporary files to be removed, got %d files", len(files))
+	}
+
+	if err = Write(filepath.Join(dir, "missing", "file.txt"), []byte("data"), 0600); err == nil {
+		t.Errorf("expected an error writing to a missing directory")
+	}
+}
@@ -0,0 +1,76 @@
+package gemini
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// FS converts an fs.FS, e.g. an embed.FS, fstest.MapFS or zip.Reader, to a FileSystem
+// that can be served by FileSystemHandler.
+//
+//	//go:embed content
+//	var content embed.FS
+//
+//	sub, err := fs.Sub(content, "content")
+//	...
+//	h := gemini.FileSystemHandler(gemini.FS(sub))
+func FS(fsys fs.FS) FileSystem {
+	return ioFS{fsys: fsys}
+}
+
+type ioFS struct {
+	fsys fs.FS
+}
+
+// Open the named file. Names are rooted at the top of the fs.FS, with or without a
+// leading slash. Names that contain . or .. elements are rejected with fs.ErrInvalid.
+func (f ioFS) Open(name string) (File, error) {
+	p, ok := validPath(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := f.fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	return ioFile{File: file, name: p}, nil
+}
+
+// validPath converts a URL path, e.g. /a/b/, to a path that can be used with fs.FS,
+// e.g. a/b, returning false if the path contains . or .. elements.
+func validPath(name string) (p string, ok bool) {
+	p = strings.TrimSuffix(strings.TrimPrefix(name, "/"), "/")
+	if p == "" {
+		p = "."
+	}
+	return p, fs.ValidPath(p)
+}
+
+type ioFile struct {
+	fs.File
+	name string
+}
+
+// errNotDir is returned when Readdir is called on a file.
+var errNotDir = errors.New("not a directory")
+
+// errNotFile is returned when Read is called on a directory.
+var errNotFile = errors.New("is a directory")
+
+func (f ioFile) Readdir(count int) (infos []os.FileInfo, err error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+	entries, err := d.ReadDir(count)
+	for _, e := range entries {
+		info, infoErr := e.Info()
+		if infoErr != nil {
+			return infos, infoErr
+		}
+		infos = append(infos, info)
+	}
+	return
+}
@@ -0,0 +1,228 @@
+package gemini
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/a-h/gemini/log"
+)
+
+const (
+	// SortByName sorts directory listings alphabetically.
+	SortByName = "name"
+	// SortByDate sorts directory listings by modification time, newest first.
+	SortByDate = "date"
+)
+
+// DirectoryListing configures the listings of directories that don't have an index file.
+// It's set in the [listing] section of a metadata file, e.g.:
+//
+//	[listing]
+//	hideDotFiles = true
+//	showSize = true
+//	showModTime = true
+//	useTitles = true
+//	sortBy = "date"
+//	directoriesFirst = true
+//	header = "header.gmi"
+//
+// The closest directory with a [listing] section configures the listing, its
+// settings aren't merged with those of parent directories.
+type DirectoryListing struct {
+	// Disabled stops the directory from being listed, a 51 (not found) response is
+	// returned instead.
+	Disabled bool `toml:"disabled"`
+	// HideDotFiles leaves files and directories whose names start with a dot out of the listing.
+	HideDotFiles bool `toml:"hideDotFiles"`
+	// ShowSize adds the size of files to their link label.
+	ShowSize bool `toml:"showSize"`
+	// ShowModTime adds the modification date of files to their link label.
+	ShowModTime bool `toml:"showModTime"`
+	// UseTitles uses the first heading of .gmi files as their link label.
+	UseTitles bool `toml:"useTitles"`
+	// SortBy is SortByName (the default) or SortByDate.
+	SortBy string `toml:"sortBy"`
+	// DirectoriesFirst lists directories before files.
+	DirectoriesFirst bool `toml:"directoriesFirst"`
+	// Header is the name of a file in the directory whose content is written at the
+	// start of the listing, instead of the "Index of" heading.
+	Header string `toml:"header"`
+	// Footer is the name of a file in the directory whose content is written at the
+	// end of the listing.
+	Footer string `toml:"footer"`
+
+	// allow returns false for files that mustn't be listed, e.g. symlinks refused by
+	// the symlink policy of FileSystemHandler.
+	allow func(name string) bool
+	// hideMetadata leaves metadata files out of the listing.
+	hideMetadata bool
+}
+
+// Validate checks that the sort order is valid.
+func (dl DirectoryListing) Validate() error {
+	if dl.SortBy != "" && dl.SortBy != SortByName && dl.SortBy != SortByDate {
+		return fmt.Errorf("gemini: invalid listing sortBy %q, expected %q or %q", dl.SortBy, SortByName, SortByDate)
+	}
+	return nil
+}
+
+// DirectoryListingHandler lists the contents of the directory f, found at path.
+func DirectoryListingHandler(path string, f File) Handler {
+	return DirectoryListing{}.Handler(nil, path, f)
+}
+
+// Handler lists the contents of the directory f, found at dir in fsys. fsys is used
+// to read the header and footer files, and the titles of .gmi files.
+func (dl DirectoryListing) Handler(fsys FileSystem, dir string, f File) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if dl.Disabled {
+			NotFound(w, r)
+			return
+		}
+		files, err := f.Readdir(-1)
+		if err != nil {
+			log.Warn("DirectoryListingHandler: readdir failed", log.String("reason", err.Error()), log.String("path", r.URL.Path), log.String("url", r.URL.String()))
+			w.SetHeader(CodeTemporaryFailure, "readdir failed")
+			return
+		}
+		files = dl.filter(dir, files)
+		dl.sort(files)
+		w.SetHeader(CodeSuccess, DefaultMIMEType)
+		if !dl.include(w, fsys, dir, dl.Header) {
+			fmt.Fprintf(w, "# Index of %s\n\n", dir)
+		}
+		if dir != "/" {
+			fmt.Fprintln(w, "=> ../")
+		}
+		for _, fi := range files {
+			name := fi.Name()
+			if fi.IsDir() {
+				name += "/"
+			}
+			u := url.URL{Path: name}
+			if label := dl.label(fsys, dir, fi); label != "" {
+				fmt.Fprintf(w, "=> %v %s\n", u.String(), label)
+				continue
+			}
+			fmt.Fprintf(w, "=> %v\n", u.String())
+		}
+		if dl.Footer != "" {
+			fmt.Fprintln(w)
+			dl.include(w, fsys, dir, dl.Footer)
+		}
+	})
+}
+
+func (dl DirectoryListing) filter(dir string, files []os.FileInfo) (filtered []os.FileInfo) {
+	filtered = files[:0]
+	for _, fi := range files {
+		name := fi.Name()
+		if (dl.hideMetadata && name == MetadataFileName) || (name == dl.Header && dl.Header != "") || (name == dl.Footer && dl.Footer != "") {
+			continue
+		}
+		if dl.HideDotFiles && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if dl.allow != nil && !dl.allow(path.Join(dir, name)) {
+			continue
+		}
+		filtered = append(filtered, fi)
+	}
+	return
+}
+
+func (dl DirectoryListing) sort(files []os.FileInfo) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if dl.DirectoriesFirst && files[i].IsDir() != files[j].IsDir() {
+			return files[i].IsDir()
+		}
+		if dl.SortBy == SortByDate && !files[i].ModTime().Equal(files[j].ModTime()) {
+			return files[i].ModTime().After(files[j].ModTime())
+		}
+		return files[i].Name() < files[j].Name()
+	})
+}
+
+// label returns the link label of the file, or an empty string if the name should be used.
+func (dl DirectoryListing) label(fsys FileSystem, dir string, fi os.FileInfo) string {
+	var title string
+	if dl.UseTitles && fsys != nil && !fi.IsDir() && path.Ext(fi.Name()) == ".gmi" {
+		title = readTitle(fsys, path.Join(dir, fi.Name()))
+	}
+	var details []string
+	if dl.ShowSize && !fi.IsDir() {
+		details = append(details, formatSize(fi.Size()))
+	}
+	if dl.ShowModTime && !fi.ModTime().IsZero() {
+		details = append(details, fi.ModTime().UTC().Format("2006-01-02"))
+	}
+	if len(details) == 0 {
+		return title
+	}
+	if title == "" {
+		title = fi.Name()
+		if fi.IsDir() {
+			title += "/"
+		}
+	}
+	return fmt.Sprintf("%s (%s)", title, strings.Join(details, ", "))
+}
+
+// include writes the content of the named file in dir to w.
+func (dl DirectoryListing) include(w io.Writer, fsys FileSystem, dir, name string) (ok bool) {
+	if name == "" || fsys == nil {
+		return false
+	}
+	f, err := fsys.Open(path.Join(dir, name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("DirectoryListingHandler: include open failed", log.String("reason", err.Error()), log.String("path", path.Join(dir, name)))
+		}
+		return false
+	}
+	defer f.Close()
+	if _, err = io.Copy(w, f); err != nil {
+		log.Error("DirectoryListingHandler: failed to write include", err, log.String("path", path.Join(dir, name)))
+		return false
+	}
+	return true
+}
+
+// maxTitleSearch is the number of bytes read from the start of a file to find its title.
+const maxTitleSearch = 4096
+
+// readTitle returns the first level one heading of a Gemini file.
+func readTitle(fsys FileSystem, name string) (title string) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(io.LimitReader(f, maxTitleSearch))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "##") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		}
+	}
+	return
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
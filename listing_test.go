@@ -0,0 +1,161 @@
+package gemini
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDirectoryListing(t *testing.T) {
+	older := time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"docs/.hidden":     &fstest.MapFile{Data: []byte("hidden")},
+		"docs/a.gmi":       &fstest.MapFile{Data: []byte("Preamble\n## Not the title\n# Apples\n"), ModTime: newer},
+		"docs/b.txt":       &fstest.MapFile{Data: make([]byte, 2048), ModTime: older},
+		"docs/sub":         &fstest.MapFile{Mode: fs.ModeDir, ModTime: older},
+		"docs/header.gmi":  &fstest.MapFile{Data: []byte("# Documents\n\n")},
+		"docs/footer.gmi":  &fstest.MapFile{Data: []byte("Last updated today.\n")},
+		"docs/untitled.gm": &fstest.MapFile{Data: []byte("# Ignored\n"), ModTime: older},
+	}
+	var tests = []struct {
+		name           string
+		listing        DirectoryListing
+		expectedHeader Header
+		expectedBody   string
+	}{
+		{
+			name:           "by default, all files are listed by name",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /docs/\n\n=> ../\n=> .hidden\n=> a.gmi\n=> b.txt\n=> footer.gmi\n=> header.gmi\n=> sub/\n=> untitled.gm\n",
+		},
+		{
+			name:           "dotfiles can be hidden",
+			listing:        DirectoryListing{HideDotFiles: true},
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /docs/\n\n=> ../\n=> a.gmi\n=> b.txt\n=> footer.gmi\n=> header.gmi\n=> sub/\n=> untitled.gm\n",
+		},
+		{
+			name:           "sizes and dates can be included in labels",
+			listing:        DirectoryListing{HideDotFiles: true, ShowSize: true, ShowModTime: true, Header: "header.gmi", Footer: "footer.gmi"},
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Documents\n\n=> ../\n=> a.gmi a.gmi (35 B, 2021-03-04)\n=> b.txt b.txt (2.0 KiB, 2020-01-02)\n=> sub/ sub/ (2020-01-02)\n=> untitled.gm untitled.gm (10 B, 2020-01-02)\n\nLast updated today.\n",
+		},
+		{
+			name:           "titles of .gmi files can be used as labels",
+			listing:        DirectoryListing{HideDotFiles: true, UseTitles: true, Header: "header.gmi", Footer: "footer.gmi"},
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Documents\n\n=> ../\n=> a.gmi Apples\n=> b.txt\n=> sub/\n=> untitled.gm\n\nLast updated today.\n",
+		},
+		{
+			name:           "files can be sorted by date, with directories first",
+			listing:        DirectoryListing{HideDotFiles: true, SortBy: SortByDate, DirectoriesFirst: true, Header: "header.gmi", Footer: "footer.gmi"},
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Documents\n\n=> ../\n=> sub/\n=> a.gmi\n=> b.txt\n=> untitled.gm\n\nLast updated today.\n",
+		},
+		{
+			name:           "missing header files are replaced with the default heading",
+			listing:        DirectoryListing{HideDotFiles: true, Header: "missing.gmi", Footer: "footer.gmi"},
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /docs/\n\n=> ../\n=> a.gmi\n=> b.txt\n=> header.gmi\n=> sub/\n=> untitled.gm\n\nLast updated today.\n",
+		},
+		{
+			name:           "listings can be disabled",
+			listing:        DirectoryListing{Disabled: true},
+			expectedHeader: Header{Code: CodeNotFound, Meta: "not found"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := FS(fsys).Open("/docs/")
+			if err != nil {
+				t.Fatalf("unexpected error opening directory: %v", err)
+			}
+			defer f.Close()
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Path: "/docs/"},
+			}
+			resp, err := Record(r, tt.listing.Handler(FS(fsys), "/docs/", f))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedHeader.Code != resp.Header.Code || tt.expectedHeader.Meta != resp.Header.Meta {
+				t.Errorf("expected header %v, got %v", tt.expectedHeader, *resp.Header)
+			}
+			bdy, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if tt.expectedBody != string(bdy) {
+				t.Errorf("expected\n%v\nactual\n%v", tt.expectedBody, string(bdy))
+			}
+		})
+	}
+}
+
+func TestDirectoryListingMetadata(t *testing.T) {
+	fsys := fstest.MapFS{
+		".meta":          &fstest.MapFile{Data: []byte("[listing]\nhideDotFiles = true\n")},
+		".hidden":        &fstest.MapFile{Data: []byte("hidden")},
+		"a.gmi":          &fstest.MapFile{Data: []byte("# A\n")},
+		"private/.meta":  &fstest.MapFile{Data: []byte("[listing]\ndisabled = true\n")},
+		"private/b.gmi":  &fstest.MapFile{Data: []byte("# B\n")},
+		"titled/.meta":   &fstest.MapFile{Data: []byte("[listing]\nuseTitles = true\n")},
+		"titled/.secret": &fstest.MapFile{Data: []byte("secret")},
+		"titled/c.gmi":   &fstest.MapFile{Data: []byte("# Cherries\n")},
+	}
+	var tests = []struct {
+		url            string
+		expectedHeader Header
+		expectedBody   string
+	}{
+		{
+			url:            "/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /\n\n=> a.gmi\n=> private/\n=> titled/\n",
+		},
+		{
+			url:            "/private/",
+			expectedHeader: Header{Code: CodeNotFound, Meta: "not found"},
+		},
+		{
+			url:            "/private/b.gmi",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# B\n",
+		},
+		{
+			url:            "/titled/",
+			expectedHeader: geminiSuccessHeader,
+			expectedBody:   "# Index of /titled/\n\n=> ../\n=> .secret\n=> c.gmi Cherries\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.url, func(t *testing.T) {
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Path: tt.url},
+			}
+			resp, err := Record(r, FileSystemHandlerWithMetadata(FS(fsys), Metadata{}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedHeader.Code != resp.Header.Code || tt.expectedHeader.Meta != resp.Header.Meta {
+				t.Errorf("expected header %v, got %v", tt.expectedHeader, *resp.Header)
+			}
+			bdy, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if tt.expectedBody != string(bdy) {
+				t.Errorf("expected\n%v\nactual\n%v", tt.expectedBody, string(bdy))
+			}
+		})
+	}
+}
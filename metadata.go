@@ -0,0 +1,212 @@
+package gemini
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/a-h/gemini/log"
+)
+
+// MetadataFileName is the name of the per-directory metadata file read by FileSystemHandler.
+const MetadataFileName = ".meta"
+
+// Metadata configures how the files in a directory, and its subdirectories, are served.
+// It's read from a TOML file named .meta in the directory, e.g.:
+//
+//	lang = "en"
+//	charset = "utf-8"
+//
+//	[mime]
+//	"*.txt" = "text/plain"
+//
+//	[status]
+//	"old.gmi" = "52 This page has been removed"
+//	"moved.gmi" = "31 /new.gmi"
+//
+//	[listing]
+//	hideDotFiles = true
+//
+// Settings in subdirectories take precedence over those of their parent directories.
+type Metadata struct {
+	// Lang is added to the MIME type of text/gemini files, e.g. lang=en.
+	Lang string `toml:"lang"`
+	// Charset is added to the MIME type of text files, e.g. charset=utf-8.
+	Charset string `toml:"charset"`
+	// MIME types for files that match a glob, e.g. "*.txt" = "text/plain". Globs
+	// are matched against the file name.
+	MIME map[string]string `toml:"mime"`
+	// Status responses for files that match a glob, e.g. "old.gmi" = "52 gone". The
+	// value is the status code, followed by a space and the meta. Files don't need
+	// to exist to be given a status.
+	Status map[string]string `toml:"status"`
+	// Listing configures the listing of directories that don't have an index file.
+	Listing *DirectoryListing `toml:"listing"`
+}
+
+// LoadMetadata reads the metadata file of the directory dir, if it has one.
+func LoadMetadata(fsys FileSystem, dir string) (m Metadata, ok bool, err error) {
+	f, err := fsys.Open(path.Join("/", dir, MetadataFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return
+	}
+	if _, err = toml.Decode(string(data), &m); err != nil {
+		err = fmt.Errorf("gemini: invalid metadata in %q: %w", path.Join(dir, MetadataFileName), err)
+		return
+	}
+	if err = m.Validate(); err != nil {
+		err = fmt.Errorf("%w in %q", err, path.Join(dir, MetadataFileName))
+		return
+	}
+	return m, true, nil
+}
+
+// Validate checks that the status responses and listing are valid.
+func (m Metadata) Validate() error {
+	for glob, status := range m.Status {
+		if _, err := parseStatus(status); err != nil {
+			return fmt.Errorf("gemini: invalid status for %q: %w", glob, err)
+		}
+	}
+	if m.Listing != nil {
+		return m.Listing.Validate()
+	}
+	return nil
+}
+
+// metadataChain is the metadata that applies to a file, ordered from the closest
+// directory to the root, ending with the defaults.
+type metadataChain []Metadata
+
+// loadMetadataChain loads the metadata files of each directory from the root to dir.
+// Invalid metadata files are logged and ignored.
+func loadMetadataChain(fsys FileSystem, dir string, defaults Metadata) (chain metadataChain) {
+	dirs := []string{"/"}
+	current := "/"
+	for _, seg := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+		current = path.Join(current, seg) + "/"
+		dirs = append(dirs, current)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		m, ok, err := LoadMetadata(fsys, dirs[i])
+		if err != nil {
+			log.Warn("FileSystemHandler: invalid metadata", log.String("reason", err.Error()), log.String("path", dirs[i]))
+			continue
+		}
+		if ok {
+			chain = append(chain, m)
+		}
+	}
+	return append(chain, defaults)
+}
+
+// match returns the value of the most specific glob that matches the name. Longer globs
+// are treated as more specific.
+func match(globs map[string]string, name string) (value string, ok bool) {
+	patterns := make([]string, 0, len(globs))
+	for p := range globs {
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	for _, p := range patterns {
+		if matched, _ := path.Match(p, name); matched {
+			return globs[p], true
+		}
+	}
+	return
+}
+
+// status returns the custom status of the named file, if it has one.
+func (mc metadataChain) status(name string) (h Header, ok bool) {
+	for _, m := range mc {
+		if s, found := match(m.Status, name); found {
+			h, err := parseStatus(s)
+			return h, err == nil
+		}
+	}
+	return
+}
+
+// listing returns the directory listing configuration of the closest directory that has one.
+func (mc metadataChain) listing() DirectoryListing {
+	for _, m := range mc {
+		if m.Listing != nil {
+			return *m.Listing
+		}
+	}
+	return DirectoryListing{}
+}
+
+func parseStatus(s string) (h Header, err error) {
+	parts := strings.SplitN(strings.TrimSpace(s), " ", 2)
+	if len(parts[0]) != 2 || parts[0][0] < '1' || parts[0][0] > '6' || parts[0][1] < '0' || parts[0][1] > '9' {
+		err = fmt.Errorf("expected a two digit status code, got %q", s)
+		return
+	}
+	h.Code = Code(parts[0])
+	if len(parts) > 1 {
+		h.Meta = strings.TrimSpace(parts[1])
+	}
+	return
+}
+
+// mimeType returns the MIME type of the named file, including the lang and charset parameters.
+func (mc metadataChain) mimeType(name string) string {
+	mType, found := "", false
+	var lang, charset string
+	for _, m := range mc {
+		if !found {
+			mType, found = match(m.MIME, name)
+		}
+		if lang == "" {
+			lang = m.Lang
+		}
+		if charset == "" {
+			charset = m.Charset
+		}
+	}
+	if !found {
+		mType = mime.TypeByExtension(path.Ext(name))
+	}
+	if mType == "" {
+		mType = DefaultMIMEType
+	}
+	if lang == "" && charset == "" {
+		return mType
+	}
+	mediaType, params, err := mime.ParseMediaType(mType)
+	if err != nil {
+		return mType
+	}
+	if charset != "" && strings.HasPrefix(mediaType, "text/") {
+		params["charset"] = charset
+	}
+	if lang != "" && mediaType == "text/gemini" {
+		params["lang"] = lang
+	}
+	if formatted := mime.FormatMediaType(mediaType, params); formatted != "" {
+		return formatted
+	}
+	return mType
+}
@@ -0,0 +1,149 @@
+package gemini
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFileSystemHandlerMetadata(t *testing.T) {
+	fsys := fstest.MapFS{
+		".meta": &fstest.MapFile{Data: []byte(`
+lang = "en"
+
+[mime]
+"*.log" = "text/plain"
+
+[status]
+"old.gmi" = "52 This page has been removed"
+"moved.gmi" = "31 /new.gmi"
+"private" = "51 not found"
+`)},
+		"index.gmi":           &fstest.MapFile{Data: []byte("# Home\n")},
+		"server.log":          &fstest.MapFile{Data: []byte("log")},
+		"moved.gmi":           &fstest.MapFile{Data: []byte("# Moved\n")},
+		"private/secret.gmi":  &fstest.MapFile{Data: []byte("# Secret\n")},
+		"fr/.meta":            &fstest.MapFile{Data: []byte("lang = \"fr\"\ncharset = \"iso-8859-1\"\n")},
+		"fr/index.gmi":        &fstest.MapFile{Data: []byte("# Accueil\n")},
+		"fr/notes.txt":        &fstest.MapFile{Data: []byte("notes")},
+		"broken/.meta":        &fstest.MapFile{Data: []byte("[status]\n\"a.gmi\" = \"gone\"\n")},
+		"broken/a.gmi":        &fstest.MapFile{Data: []byte("# A\n")},
+		"defaults/readme.gmi": &fstest.MapFile{Data: []byte("# Readme\n")},
+	}
+	var tests = []struct {
+		name           string
+		url            string
+		defaults       Metadata
+		expectedHeader Header
+	}{
+		{
+			name:           "lang is added to text/gemini files",
+			url:            "/",
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/gemini; charset=utf-8; lang=en"},
+		},
+		{
+			name:           "MIME types can be overridden by glob",
+			url:            "/server.log",
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/plain"},
+		},
+		{
+			name:           "files that don't exist can be marked as gone",
+			url:            "/old.gmi",
+			expectedHeader: Header{Code: "52", Meta: "This page has been removed"},
+		},
+		{
+			name:           "files can be redirected",
+			url:            "/moved.gmi",
+			expectedHeader: Header{Code: CodeRedirectPermanent, Meta: "/new.gmi"},
+		},
+		{
+			name:           "directories can be given a status",
+			url:            "/private/",
+			expectedHeader: Header{Code: CodeNotFound, Meta: "not found"},
+		},
+		{
+			name:           "subdirectories override their parents",
+			url:            "/fr/",
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/gemini; charset=iso-8859-1; lang=fr"},
+		},
+		{
+			name:           "charset is added to other text files",
+			url:            "/fr/notes.txt",
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/plain; charset=iso-8859-1"},
+		},
+		{
+			name:           "invalid metadata files are ignored",
+			url:            "/broken/a.gmi",
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/gemini; charset=utf-8; lang=en"},
+		},
+		{
+			name:           "metadata files aren't served",
+			url:            "/.meta",
+			expectedHeader: Header{Code: CodeNotFound, Meta: "not found"},
+		},
+		{
+			name:           "defaults apply when there are no metadata files",
+			url:            "/defaults/readme.gmi",
+			defaults:       Metadata{Lang: "de"},
+			expectedHeader: Header{Code: CodeSuccess, Meta: "text/gemini; charset=utf-8; lang=en"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := FileSystemHandlerWithMetadata(FS(fsys), tt.defaults)
+			r := &Request{
+				Context: context.Background(),
+				URL:     &url.URL{Path: tt.url},
+			}
+			resp, err := Record(r, h)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedHeader.Code != resp.Header.Code || tt.expectedHeader.Meta != resp.Header.Meta {
+				t.Errorf("expected header %v, got %v", tt.expectedHeader, *resp.Header)
+			}
+		})
+	}
+}
+
+func TestMetadataDefaults(t *testing.T) {
+	fsys := fstest.MapFS{
+		"readme.gmi": &fstest.MapFile{Data: []byte("# Readme\n")},
+	}
+	h := FileSystemHandlerWithMetadata(FS(fsys), Metadata{Lang: "de", Status: map[string]string{"old.gmi": "52 gone"}})
+	for path, expected := range map[string]Header{
+		"/readme.gmi": {Code: CodeSuccess, Meta: "text/gemini; charset=utf-8; lang=de"},
+		"/old.gmi":    {Code: "52", Meta: "gone"},
+	} {
+		resp, err := Record(&Request{Context: context.Background(), URL: &url.URL{Path: path}}, h)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected.Code != resp.Header.Code || expected.Meta != resp.Header.Meta {
+			t.Errorf("%s: expected header %v, got %v", path, expected, *resp.Header)
+		}
+	}
+}
+
+func TestMetadataFilesDisabled(t *testing.T) {
+	fsys := fstest.MapFS{
+		".meta":      &fstest.MapFile{Data: []byte("lang = \"fr\"\n[status]\n\"old.gmi\" = \"52 gone\"\n")},
+		"readme.gmi": &fstest.MapFile{Data: []byte("# Readme\n")},
+	}
+	h := FileSystemHandlerWithOptions(FS(fsys), FileServerOptions{Metadata: Metadata{Lang: "de"}})
+	for path, expected := range map[string]Header{
+		"/readme.gmi": {Code: CodeSuccess, Meta: "text/gemini; charset=utf-8; lang=de"},
+		"/old.gmi":    {Code: CodeNotFound, Meta: "not found"},
+		"/.meta":      {Code: CodeSuccess, Meta: "text/gemini; charset=utf-8; lang=de"},
+	} {
+		resp, err := Record(&Request{Context: context.Background(), URL: &url.URL{Path: path}}, h)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected.Code != resp.Header.Code || expected.Meta != resp.Header.Meta {
+			t.Errorf("%s: expected header %v, got %v", path, expected, *resp.Header)
+		}
+	}
+}
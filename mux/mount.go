@@ -0,0 +1,160 @@
+package mux
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/a-h/gemini"
+)
+
+// Mount routes requests for the prefix, and any path below it, to the handler. The prefix
+// is stripped from the URL path before it's passed to the handler, and recorded in the
+// MatchedRoute. The prefix can contain variables, e.g. /users/{id}/posts.
+//
+//	api := mux.NewMux()
+//	api.AddRoute("/status", statusHandler)
+//	m.Mount("/api", api) // gemini://example.com/api/status is routed to statusHandler.
+//
+// If the handler is a *Mux, URLs built by the mounted Mux include the prefix.
+func (m *Mux) Mount(prefix string, handler gemini.Handler) {
+	sub, _ := handler.(*Mux)
+	m.mount(prefix, handler, sub)
+}
+
+// mount the handler at the prefix. If sub isn't nil, it's the Mux that the handler serves,
+// which may be wrapped in middleware.
+func (m *Mux) mount(prefix string, handler gemini.Handler, sub *Mux) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	route := NewRoute(strings.TrimSuffix(prefix, "/") + "/{...}")
+	n := len(route.Segments) - 1
+	if sub != nil {
+		sub.m.Lock()
+		sub.mountedIn = m
+		sub.mountPattern = NewRoute(prefix)
+		sub.m.Unlock()
+	}
+	m.AddRoute(route.Pattern, gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		mr, _ := GetMatchedRoute(r.Context)
+		mounted, path := splitSegments(r.URL.Path, n)
+		mr.Mount += mounted
+		r2 := new(gemini.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		r2.Context = context.WithValue(r.Context, matchedRouteContextKey, mr)
+		handler.ServeGemini(w, r2)
+	}))
+}
+
+// splitSegments splits the path after the first n segments. The remainder always starts
+// with a /, and retains any trailing slash.
+func splitSegments(path string, n int) (prefix, remainder string) {
+	i := 0
+	for ; n > 0 && i < len(path); n-- {
+		j := strings.Index(path[i+1:], "/")
+		if j < 0 {
+			i = len(path)
+			break
+		}
+		i += j + 1
+	}
+	prefix, remainder = path[:i], path[i:]
+	if remainder == "" {
+		remainder = "/"
+	}
+	return
+}
+
+// Middleware wraps a handler, e.g. to require a client certificate.
+type Middleware func(next gemini.Handler) gemini.Handler
+
+// Group of routes that share a path prefix and middleware.
+type Group struct {
+	mux         *Mux
+	prefix      string
+	middlewares []Middleware
+}
+
+// Group returns a group of routes within the Mux. Routes added to the group are prefixed
+// with the prefix, and wrapped with the middlewares, the first being the outermost.
+//
+//	admin := m.Group("/admin", requireAdmin)
+//	admin.AddRoute("/users", usersHandler) // Adds /admin/users.
+func (m *Mux) Group(prefix string, middlewares ...Middleware) *Group {
+	return &Group{
+		mux:         m,
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		middlewares: middlewares,
+	}
+}
+
+// AddRoute adds a route to the Mux, prefixed with the group prefix, and wrapped with the
+// group middleware.
+func (g *Group) AddRoute(pattern string, handler gemini.Handler, opts ...RouteOption) {
+	g.mux.AddRoute(g.prefix+"/"+strings.TrimPrefix(pattern, "/"), g.wrap(handler), opts...)
+}
+
+// Mount a handler within the group, see Mux.Mount.
+func (g *Group) Mount(prefix string, handler gemini.Handler) {
+	sub, _ := handler.(*Mux)
+	g.mux.mount(g.prefix+"/"+strings.TrimPrefix(prefix, "/"), g.wrap(handler), sub)
+}
+
+// Group returns a group nested within this group. Routes in the nested group use the
+// prefixes and middleware of both groups.
+func (g *Group) Group(prefix string, middlewares ...Middleware) *Group {
+	return &Group{
+		mux:         g.mux,
+		prefix:      g.prefix + "/" + strings.Trim(prefix, "/"),
+		middlewares: append(append([]Middleware{}, g.middlewares...), middlewares...),
+	}
+}
+
+func (g *Group) wrap(h gemini.Handler) gemini.Handler {
+	for i := len(g.middlewares) - 1; i >= 0; i-- {
+		h = g.middlewares[i](h)
+	}
+	return h
+}
+
+// Host returns a Mux that routes requests for the hostname, e.g. "docs.example.org".
+// Requests for hosts that don't have their own Mux are routed by m. Calling Host again
+// with the same hostname returns the same Mux.
+func (m *Mux) Host(hostname string) *Mux {
+	hostname = normaliseHost(hostname)
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.hosts == nil {
+		m.hosts = make(map[string]*Mux)
+	}
+	hm, ok := m.hosts[hostname]
+	if !ok {
+		hm = NewMux()
+		hm.NotFoundHandler = m.NotFoundHandler
+		hm.host = hostname
+		m.hosts[hostname] = hm
+	}
+	return hm
+}
+
+func (m *Mux) getHost(u *url.URL) (hm *Mux, ok bool) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+	if len(m.hosts) == 0 {
+		return
+	}
+	hm, ok = m.hosts[normaliseHost(u.Host)]
+	return
+}
+
+// normaliseHost removes the port from a host, and converts it to lower case.
+func normaliseHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
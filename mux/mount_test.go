@@ -0,0 +1,106 @@
+package mux
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/a-h/gemini"
+)
+
+func describe(name string) gemini.Handler {
+	return gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		mr, _ := GetMatchedRoute(r.Context)
+		fmt.Fprintf(w, "%s path=%s mount=%s vars=%v", name, r.URL.Path, mr.Mount, mr.PathVars)
+	})
+}
+
+func TestMountGroupHost(t *testing.T) {
+	users := NewMux()
+	users.AddRoute("/", describe("posts"))
+	users.AddRoute("/{post}", describe("post"))
+
+	api := NewMux()
+	api.AddRoute("/status", describe("status"))
+	api.Mount("/users/{id}/posts", users)
+
+	m := NewMux()
+	m.AddRoute("/", describe("home"))
+	m.Mount("/api", api)
+	m.Mount("/files", describe("files"))
+
+	addHeader := func(value string) Middleware {
+		return func(next gemini.Handler) gemini.Handler {
+			return gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+				w.Write([]byte(value))
+				next.ServeGemini(w, r)
+			})
+		}
+	}
+	admin := m.Group("/admin", addHeader("a:"))
+	admin.AddRoute("/users", describe("admin users"))
+	admin.Group("/settings", addHeader("b:")).AddRoute("/", describe("settings"))
+	reports := NewMux()
+	reports.AddRoute("/{report}", describe("report"))
+	admin.Mount("/reports", reports)
+
+	docs := m.Host("Docs.Example.org")
+	docs.AddRoute("/", describe("docs"))
+
+	var tests = []struct {
+		url      string
+		expected string
+	}{
+		{url: "gemini://example.org/", expected: "home path=/ mount= vars=map[]"},
+		{url: "gemini://example.org/api/status", expected: "status path=/status mount=/api vars=map[]"},
+		{url: "gemini://example.org/api/users/12/posts", expected: "posts path=/ mount=/api/users/12/posts vars=map[id:12]"},
+		{url: "gemini://example.org/api/users/12/posts/hello", expected: "post path=/hello mount=/api/users/12/posts vars=map[id:12 post:hello]"},
+		{url: "gemini://example.org/files/a/b/", expected: "files path=/a/b/ mount=/files vars=map[]"},
+		{url: "gemini://example.org/admin/users", expected: "a:admin users path=/admin/users mount= vars=map[]"},
+		{url: "gemini://example.org/admin/settings", expected: "a:b:settings path=/admin/settings mount= vars=map[]"},
+		{url: "gemini://example.org/admin/reports/daily", expected: "a:report path=/daily mount=/admin/reports vars=map[report:daily]"},
+		{url: "gemini://docs.example.org:1965/", expected: "docs path=/ mount= vars=map[]"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatalf("failed to parse URL %q: %v", tt.url, err)
+			}
+			resp, err := gemini.Record(&gemini.Request{Context: context.Background(), URL: u}, m)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			bdy, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if string(bdy) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, string(bdy))
+			}
+		})
+	}
+}
+
+func TestSplitSegments(t *testing.T) {
+	var tests = []struct {
+		path              string
+		n                 int
+		prefix, remainder string
+	}{
+		{path: "/a/b/c", n: 0, prefix: "", remainder: "/a/b/c"},
+		{path: "/a/b/c", n: 1, prefix: "/a", remainder: "/b/c"},
+		{path: "/a/b/c/", n: 2, prefix: "/a/b", remainder: "/c/"},
+		{path: "/a/b", n: 2, prefix: "/a/b", remainder: "/"},
+		{path: "/a/b/", n: 2, prefix: "/a/b", remainder: "/"},
+	}
+	for _, tt := range tests {
+		prefix, remainder := splitSegments(tt.path, tt.n)
+		if prefix != tt.prefix || remainder != tt.remainder {
+			t.Errorf("splitSegments(%q, %d): expected %q, %q, got %q, %q", tt.path, tt.n, tt.prefix, tt.remainder, prefix, remainder)
+		}
+	}
+}
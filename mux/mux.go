@@ -2,15 +2,41 @@ package mux
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/a-h/gemini"
 )
 
 // Mux routes Gemini requests to the appropriate handler.
+//
+// Routes are matched segment by segment. Static segments are preferred over
+// constrained variables ({id:int}), constrained variables over other variables,
+// variables over wildcards, and wildcards over catch-all variables ({path...}),
+// regardless of the order that routes were added. A wildcard (*) matches a single
+// segment, or, at the end of a route, the rest of the path. A catch-all variable
+// captures the rest of the path, which may be empty.
 type Mux struct {
+	// RouteHandlers registered with the Mux. Use AddRoute to add routes.
 	RouteHandlers   []*RouteHandler
 	NotFoundHandler gemini.Handler
+
+	m sync.RWMutex
+	// tree of the RouteHandlers, and the routes it was built from.
+	tree     *node
+	treeFrom []routeIdentity
+	// hosts routed by their own Mux, see Host.
+	hosts map[string]*Mux
+	// names of routes, used to build URLs.
+	names map[string]*RouteHandler
+	// host that the Mux routes requests for, if it was created by Host.
+	host string
+	// mountedIn is the Mux that this Mux is mounted in, at mountPattern.
+	mountedIn    *Mux
+	mountPattern *Route
 }
 
 // NewMux creates a new Mux for routing requests.
@@ -21,19 +47,126 @@ func NewMux() *Mux {
 	}
 }
 
-// AddRoute to the mux.
-func (m *Mux) AddRoute(pattern string, handler gemini.Handler) {
+// RouteOption configures a route added with AddRoute.
+type RouteOption func(rh *RouteHandler)
+
+// Name the route, so that URLs to it can be built with Mux.URL.
+func Name(name string) RouteOption {
+	return func(rh *RouteHandler) {
+		rh.Name = name
+	}
+}
+
+// WithoutInput routes requests that don't have input (an empty query) to h instead of
+// the route handler, e.g. to show a form before prompting, or to prompt for input.
+//
+//	m.AddRoute("/search", searchResultsHandler, mux.WithoutInput(searchPageHandler))
+func WithoutInput(h gemini.Handler) RouteOption {
+	return func(rh *RouteHandler) {
+		withInput := rh.Handler
+		rh.Handler = gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+			if r.HasInput() {
+				withInput.ServeGemini(w, r)
+				return
+			}
+			h.ServeGemini(w, r)
+		})
+	}
+}
+
+// AddRoute to the mux. AddRoute panics if the pattern conflicts with an existing
+// route, e.g. /users/{id} and /users/{name}, or if the route name is already used.
+func (m *Mux) AddRoute(pattern string, handler gemini.Handler, opts ...RouteOption) {
 	rh := &RouteHandler{
 		Route:   NewRoute(pattern),
 		Handler: handler,
 	}
+	for _, o := range opts {
+		o(rh)
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	if _, ok := m.names[rh.Name]; ok && rh.Name != "" {
+		panic(fmt.Sprintf("mux: route name %q is already used", rh.Name))
+	}
+	tree := m.getTree()
+	if err := tree.insert(rh); err != nil {
+		panic(err)
+	}
 	m.RouteHandlers = append(m.RouteHandlers, rh)
+	m.treeFrom = append(m.treeFrom, identify(rh))
+	if rh.Name != "" {
+		if m.names == nil {
+			m.names = make(map[string]*RouteHandler)
+		}
+		m.names[rh.Name] = rh
+	}
+}
+
+// getTree returns the routing tree, rebuilding it if RouteHandlers has been
+// modified directly. When routes conflict, the first route is used. The caller
+// must hold the write lock.
+func (m *Mux) getTree() *node {
+	if m.tree != nil && m.treeIsCurrent() {
+		return m.tree
+	}
+	m.tree = newNode()
+	m.treeFrom = make([]routeIdentity, len(m.RouteHandlers))
+	for i, rh := range m.RouteHandlers {
+		m.tree.insert(rh)
+		m.treeFrom[i] = identify(rh)
+	}
+	return m.tree
+}
+
+// routeIdentity identifies a route in the tree, so that changes to RouteHandlers, including
+// changes to the routes of existing RouteHandlers, can be detected.
+type routeIdentity struct {
+	handler *RouteHandler
+	route   *Route
+	pattern string
+}
+
+func identify(rh *RouteHandler) routeIdentity {
+	id := routeIdentity{handler: rh, route: rh.Route}
+	if rh.Route != nil {
+		id.pattern = rh.Route.Pattern
+	}
+	return id
+}
+
+// treeIsCurrent returns true if the tree was built from the current RouteHandlers. The
+// caller must hold the lock.
+func (m *Mux) treeIsCurrent() bool {
+	if len(m.treeFrom) != len(m.RouteHandlers) {
+		return false
+	}
+	for i, rh := range m.RouteHandlers {
+		if m.treeFrom[i] != identify(rh) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Mux) find(segments []string) (rh *RouteHandler, vars map[string]string) {
+	m.m.RLock()
+	if m.tree != nil && m.treeIsCurrent() {
+		defer m.m.RUnlock()
+		return m.tree.match(segments)
+	}
+	m.m.RUnlock()
+	m.m.Lock()
+	defer m.m.Unlock()
+	return m.getTree().match(segments)
 }
 
 // RouteHandler is the Handler to use for a given Route.
 type RouteHandler struct {
 	Route   *Route
 	Handler gemini.Handler
+	// Name of the route, used to build URLs, see Mux.URL.
+	Name string
 }
 
 // contextKey used to store the route handler in the request context.
@@ -46,31 +179,106 @@ const matchedRouteContextKey = contextKey("matchedRoute")
 type MatchedRoute struct {
 	Pattern  string
 	PathVars map[string]string
+	// Mount is the path prefix that was stripped from the request URL before it was
+	// passed to the handler, see Mux.Mount. Path variables captured by the mount
+	// prefix are included in PathVars.
+	Mount string
 }
 
 func (m *Mux) ServeGemini(w gemini.ResponseWriter, r *gemini.Request) {
+	if hm, ok := m.getHost(r.URL); ok {
+		hm.ServeGemini(w, r)
+		return
+	}
+
 	s := r.URL.Path
 	s = strings.TrimSuffix(s, "/")
 	s = strings.TrimPrefix(s, "/")
 	segments := strings.Split(s, "/")
 
-	for _, rh := range m.RouteHandlers {
-		v, ok := rh.Route.Match(segments)
-		if ok {
-			mr := MatchedRoute{
-				Pattern:  rh.Route.Pattern,
-				PathVars: v,
+	if rh, v := m.find(segments); rh != nil {
+		mr := MatchedRoute{
+			Pattern:  rh.Route.Pattern,
+			PathVars: v,
+		}
+		// Include the mount prefix and path variables of the Mux that this Mux is mounted in.
+		if parent, ok := GetMatchedRoute(r.Context); ok && parent.Mount != "" {
+			mr.Mount = parent.Mount
+			for k, v := range parent.PathVars {
+				if _, ok := mr.PathVars[k]; !ok {
+					mr.PathVars[k] = v
+				}
 			}
-			r.Context = context.WithValue(r.Context, matchedRouteContextKey, mr)
-			rh.Handler.ServeGemini(w, r)
-			return
 		}
+		r.Context = context.WithValue(r.Context, matchedRouteContextKey, mr)
+		rh.Handler.ServeGemini(w, r)
+		return
 	}
 	m.NotFoundHandler.ServeGemini(w, r)
 }
 
+// ErrMissingVar is returned when a path variable isn't part of the matched route.
+var ErrMissingVar = errors.New("mux: missing path variable")
+
+// ErrInvalidVar is returned when a path variable can't be parsed.
+var ErrInvalidVar = errors.New("mux: invalid path variable")
+
+// Var returns the value of a path variable.
+func (mr MatchedRoute) Var(name string) (v string, ok bool) {
+	v, ok = mr.PathVars[name]
+	return
+}
+
+// Int parses a path variable as an integer. ErrMissingVar is returned if the route
+// doesn't have the variable, and ErrInvalidVar if it isn't an integer.
+func (mr MatchedRoute) Int(name string) (v int, err error) {
+	s, ok := mr.Var(name)
+	if !ok {
+		err = fmt.Errorf("%w %q", ErrMissingVar, name)
+		return
+	}
+	if v, err = strconv.Atoi(s); err != nil {
+		err = fmt.Errorf("%w %q: %v", ErrInvalidVar, name, err)
+	}
+	return
+}
+
+// Var returns the value of a path variable from the request. If the request wasn't
+// routed by a Mux, or the route doesn't have the variable, a 51 (not found) response
+// is written and ok is false.
+func Var(w gemini.ResponseWriter, r *gemini.Request, name string) (v string, ok bool) {
+	mr, ok := GetMatchedRoute(r.Context)
+	if ok {
+		v, ok = mr.Var(name)
+	}
+	if !ok {
+		gemini.NotFound(w, r)
+	}
+	return
+}
+
+// Int parses a path variable from the request as an integer. If the request wasn't routed
+// by a Mux, or the route doesn't have the variable, a 51 (not found) response is written.
+// If the variable isn't an integer, a 59 (bad request) response is written. Use an {id:int}
+// constraint in the route to return 51 for invalid values instead.
+func Int(w gemini.ResponseWriter, r *gemini.Request, name string) (v int, ok bool) {
+	s, ok := Var(w, r, name)
+	if !ok {
+		return
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		gemini.BadRequest(w, r)
+		return v, false
+	}
+	return v, true
+}
+
 // GetMatchedRoute returns the route that was matched by the router, along with any path variables extracted from the URL.
 func GetMatchedRoute(ctx context.Context) (mr MatchedRoute, ok bool) {
+	if ctx == nil {
+		return
+	}
 	mr, ok = ctx.Value(matchedRouteContextKey).(MatchedRoute)
 	return mr, ok
 }
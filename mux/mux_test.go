@@ -116,3 +116,135 @@ func TestAddRoute(t *testing.T) {
 		t.Errorf("expected 1 route handler to be added, got %d", len(m.RouteHandlers))
 	}
 }
+
+func TestRouteHandlersChanged(t *testing.T) {
+	text := func(s string) gemini.Handler {
+		return gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+			w.Write([]byte(s))
+		})
+	}
+	m := NewMux()
+	m.AddRoute("/a", text("a"))
+	m.AddRoute("/b", text("b"))
+	get := func(path string) string {
+		resp, err := gemini.Record(&gemini.Request{Context: context.Background(), URL: &url.URL{Path: path}}, m)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		bdy, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("unexpected error reading body: %v", err)
+		}
+		return string(bdy)
+	}
+	if actual := get("/a"); actual != "a" {
+		t.Fatalf("expected %q, got %q", "a", actual)
+	}
+	// Replacing a route in place, without changing the length of RouteHandlers, is picked up.
+	m.RouteHandlers[0] = &RouteHandler{Route: NewRoute("/c"), Handler: text("c")}
+	if actual := get("/c"); actual != "c" {
+		t.Errorf("expected the replaced route to be used, got %q", actual)
+	}
+	// As are changes to the route of an existing RouteHandler.
+	m.RouteHandlers[1].Route = NewRoute("/d")
+	if actual := get("/d"); actual != "b" {
+		t.Errorf("expected the changed route to be used, got %q", actual)
+	}
+}
+
+func TestIntVar(t *testing.T) {
+	var tests = []struct {
+		name           string
+		pattern        string
+		requestURL     string
+		expectedHeader gemini.Header
+		expectedBody   string
+	}{
+		{
+			name:           "valid integers are parsed",
+			pattern:        "/users/{id}",
+			requestURL:     "/users/123",
+			expectedHeader: gemini.Header{Code: gemini.CodeSuccess, Meta: gemini.DefaultMIMEType},
+			expectedBody:   "124",
+		},
+		{
+			name:           "invalid integers return a bad request",
+			pattern:        "/users/{id}",
+			requestURL:     "/users/abc",
+			expectedHeader: gemini.Header{Code: gemini.CodeBadRequest, Meta: "bad request"},
+		},
+		{
+			name:           "constrained variables return not found for invalid values",
+			pattern:        "/users/{id:int}",
+			requestURL:     "/users/abc",
+			expectedHeader: gemini.Header{Code: gemini.CodeNotFound, Meta: "not found"},
+		},
+		{
+			name:           "missing variables return not found",
+			pattern:        "/users/{name}",
+			requestURL:     "/users/123",
+			expectedHeader: gemini.Header{Code: gemini.CodeNotFound, Meta: "not found"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMux()
+			m.AddRoute(tt.pattern, gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+				id, ok := Int(w, r, "id")
+				if !ok {
+					return
+				}
+				w.Write([]byte(fmt.Sprint(id + 1)))
+			}))
+			u, err := url.Parse(tt.requestURL)
+			if err != nil {
+				t.Fatalf("failed to parse URL %q: %v", tt.requestURL, err)
+			}
+			resp, err := gemini.Record(&gemini.Request{Context: context.Background(), URL: u}, m)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.Header.Code != tt.expectedHeader.Code || resp.Header.Meta != tt.expectedHeader.Meta {
+				t.Errorf("expected header %v, got %v", tt.expectedHeader, *resp.Header)
+			}
+			bdy, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if tt.expectedBody != string(bdy) {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, string(bdy))
+			}
+		})
+	}
+}
+
+func TestWithoutInput(t *testing.T) {
+	m := NewMux()
+	m.AddRoute("/search", gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		input, _ := r.Input()
+		w.Write([]byte("results for " + input))
+	}), WithoutInput(gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		w.SetHeader(gemini.CodeInput, "Search")
+	})))
+	var tests = []struct {
+		rawQuery       string
+		expectedHeader gemini.Header
+	}{
+		{rawQuery: "", expectedHeader: gemini.Header{Code: gemini.CodeInput, Meta: "Search"}},
+		{rawQuery: "gemini", expectedHeader: gemini.Header{Code: gemini.CodeSuccess, Meta: gemini.DefaultMIMEType}},
+	}
+	for _, tt := range tests {
+		r := &gemini.Request{
+			Context: context.Background(),
+			URL:     &url.URL{Path: "/search", RawQuery: tt.rawQuery},
+		}
+		resp, err := gemini.Record(r, m)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Header.Code != tt.expectedHeader.Code || resp.Header.Meta != tt.expectedHeader.Meta {
+			t.Errorf("%q: expected header %v, got %v", tt.rawQuery, tt.expectedHeader, *resp.Header)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package mux
 
 import (
+	"fmt"
 	"strings"
 )
 
@@ -10,60 +11,91 @@ type Route struct {
 	Segments []*Segment
 }
 
-// NewRoute creates a route based on a pattern, e.g /users/{userid}.
+// NewRoute creates a route based on a pattern, e.g /users/{userid}. NewRoute panics
+// if the pattern is invalid, see ParseRoute.
 func NewRoute(pattern string) *Route {
-	var r Route
-	r.Pattern = pattern
+	r, err := ParseRoute(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// ParseRoute creates a route based on a pattern, e.g. /users/{userid}, /users/{id:int}
+// or /files/{path...}. An error is returned if a constraint isn't a valid regular
+// expression, or a catch-all variable isn't the last segment.
+func ParseRoute(pattern string) (r *Route, err error) {
+	r = &Route{
+		Pattern: pattern,
+	}
 
 	pattern = strings.TrimSuffix(pattern, "/")
 	pattern = strings.TrimPrefix(pattern, "/")
 
-	for _, seg := range strings.Split(pattern, "/") {
-		ps := &Segment{
-			Name: seg,
-		}
-		if seg == "*" {
-			ps.IsWildcard = true
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		ps, err := NewSegment(seg)
+		if err != nil {
+			return nil, err
 		}
-		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
-			ps.IsVariable = true
-			ps.Name = strings.TrimSuffix(strings.TrimPrefix(seg, "{"), "}")
+		if ps.IsCatchAll && i != len(segments)-1 {
+			return nil, fmt.Errorf("mux: catch-all variable %q must be the last segment of %q", seg, r.Pattern)
 		}
 		r.Segments = append(r.Segments, ps)
 	}
-
-	return &r
+	return
 }
 
-// Match returns whether the route was matched, and extracts variables.
+// Match returns whether the route was matched, and extracts variables. It uses the same
+// rules as Mux, so constraints, wildcards and catch-all variables are supported.
 func (r Route) Match(segments []string) (vars map[string]string, ok bool) {
-	vars = make(map[string]string)
-	var wildcard bool
-	for i := 0; i < len(r.Segments); i++ {
-		routeSegment := r.Segments[len(r.Segments)-1-i]
-		inputSegmentIndex := len(segments) - 1 - i
-		var inputSegment string
-		if inputSegmentIndex > -1 {
-			inputSegment = segments[inputSegmentIndex]
-		}
-		name, capture, wildcardMatch, matches := routeSegment.Match(inputSegment)
-		if matches {
-			if wildcardMatch {
-				wildcard = true
-			} else {
-				wildcard = false
-			}
+	if !r.matches(segments) {
+		return
+	}
+	return r.vars(segments), true
+}
+
+func (r Route) matches(segments []string) bool {
+	for i, seg := range r.Segments {
+		if seg.IsCatchAll {
+			return true
 		}
-		if wildcard {
-			matches = true
+		if i >= len(segments) {
+			return false
 		}
-		if !matches {
-			return
+		switch {
+		case seg.IsWildcard:
+			// A wildcard at the end of a route matches the rest of the path.
+			if i == len(r.Segments)-1 {
+				return true
+			}
+		case seg.IsVariable:
+			if seg.constraint != nil && !seg.constraint(segments[i]) {
+				return false
+			}
+		case !strings.EqualFold(seg.Name, segments[i]):
+			return false
 		}
-		if capture {
-			vars[name] = inputSegment
+	}
+	return len(segments) == len(r.Segments)
+}
+
+// vars captures the path variables of a route that matches the segments.
+func (r Route) vars(segments []string) (vars map[string]string) {
+	vars = make(map[string]string)
+	for i, seg := range r.Segments {
+		switch {
+		case seg.IsCatchAll && seg.Name == "":
+			// Unnamed catch-alls are used by Mux.Mount, and aren't captured.
+		case seg.IsCatchAll:
+			if i < len(segments) {
+				vars[seg.Name] = strings.Join(segments[i:], "/")
+			} else {
+				vars[seg.Name] = ""
+			}
+		case seg.IsVariable && i < len(segments):
+			vars[seg.Name] = segments[i]
 		}
 	}
-	ok = true
 	return
 }
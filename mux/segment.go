@@ -2,15 +2,69 @@ package mux
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 // Segment is a path segment, e.g. in /users/{userid}/ there are two segments,
 // "users" and "{userid}". "{userid}" is a variable and will be captured.
+//
+// Variables can be constrained with a type or a regular expression, e.g. {id:int}
+// or {slug:[a-z-]+}. A variable ending in ..., e.g. {path...}, is a catch-all that
+// captures the rest of the path.
 type Segment struct {
 	Name       string
 	IsVariable bool
 	IsWildcard bool
+	// IsCatchAll is true for variables that capture the rest of the path, e.g. {path...}.
+	IsCatchAll bool
+	// Constraint on the value of a variable, e.g. "int" or "[a-z-]+".
+	Constraint string
+	constraint func(s string) bool
+}
+
+// Constraints that can be used by name in variables, e.g. {id:int}.
+var Constraints = map[string]func(s string) bool{
+	"int": func(s string) bool {
+		_, err := strconv.Atoi(s)
+		return err == nil
+	},
+}
+
+// NewSegment parses a path segment, e.g. "users", "{id}", "{id:int}", "{path...}" or "*".
+func NewSegment(seg string) (ps *Segment, err error) {
+	ps = &Segment{
+		Name: seg,
+	}
+	if seg == "*" {
+		ps.IsWildcard = true
+		return
+	}
+	if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+		return
+	}
+	ps.IsVariable = true
+	ps.Name = strings.TrimSuffix(strings.TrimPrefix(seg, "{"), "}")
+	if strings.HasSuffix(ps.Name, "...") {
+		ps.IsCatchAll = true
+		ps.Name = strings.TrimSuffix(ps.Name, "...")
+		return
+	}
+	if i := strings.Index(ps.Name, ":"); i >= 0 {
+		ps.Name, ps.Constraint = ps.Name[:i], ps.Name[i+1:]
+		if f, ok := Constraints[ps.Constraint]; ok {
+			ps.constraint = f
+			return
+		}
+		re, reErr := regexp.Compile("^(?:" + ps.Constraint + ")$")
+		if reErr != nil {
+			err = fmt.Errorf("mux: invalid constraint in segment %q: %w", seg, reErr)
+			return
+		}
+		ps.constraint = re.MatchString
+	}
+	return
 }
 
 // String pretty prints the segment, for debugging.
@@ -26,7 +80,17 @@ func (ps *Segment) Match(s string) (name string, capture bool, wildcard bool, ma
 		matches = true
 		return
 	}
+	if ps.IsCatchAll {
+		name = ps.Name
+		capture = true
+		wildcard = true
+		matches = true
+		return
+	}
 	if ps.IsVariable {
+		if ps.constraint != nil && !ps.constraint(s) {
+			return
+		}
 		name = ps.Name
 		capture = true
 		matches = true
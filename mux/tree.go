@@ -0,0 +1,130 @@
+package mux
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// node in the routing tree. Each level of the tree matches a path segment.
+// Static segments are preferred over constrained variables, constrained variables
+// over other variables, variables over wildcards, and wildcards over catch-all
+// variables, regardless of the order that routes were added.
+type node struct {
+	static map[string]*node
+	// variables are ordered so that constrained variables are tried first.
+	variables []*node
+	wildcard  *node
+	catchAll  *node
+	// segment matched by a variable node.
+	segment *Segment
+	// route that ends at this node.
+	route *RouteHandler
+}
+
+func newNode() *node {
+	return &node{
+		static: make(map[string]*node),
+	}
+}
+
+// insert the route into the tree. An error is returned if a route with the same
+// shape, e.g. /users/{id} and /users/{name}, has already been added.
+func (n *node) insert(rh *RouteHandler) error {
+	current := n
+	for _, seg := range rh.Route.Segments {
+		current = current.child(seg)
+	}
+	if current.route != nil {
+		return fmt.Errorf("mux: route %q conflicts with existing route %q", rh.Route.Pattern, current.route.Route.Pattern)
+	}
+	current.route = rh
+	return nil
+}
+
+// child returns the node that matches the segment, creating it if required.
+func (n *node) child(seg *Segment) *node {
+	switch {
+	case seg.IsCatchAll:
+		if n.catchAll == nil {
+			n.catchAll = newNode()
+		}
+		return n.catchAll
+	case seg.IsWildcard:
+		if n.wildcard == nil {
+			n.wildcard = newNode()
+		}
+		return n.wildcard
+	case seg.IsVariable:
+		for _, v := range n.variables {
+			if v.segment.Constraint == seg.Constraint {
+				return v
+			}
+		}
+		child := newNode()
+		child.segment = seg
+		n.variables = append(n.variables, child)
+		sort.SliceStable(n.variables, func(i, j int) bool {
+			return n.variables[i].segment.Constraint != "" && n.variables[j].segment.Constraint == ""
+		})
+		return child
+	}
+	key := strings.ToLower(seg.Name)
+	child, ok := n.static[key]
+	if !ok {
+		child = newNode()
+		n.static[key] = child
+	}
+	return child
+}
+
+// match the path segments against the tree, returning the route handler and the captured
+// path variables. If a branch doesn't lead to a route, the next most specific branch is tried.
+func (n *node) match(segments []string) (rh *RouteHandler, vars map[string]string) {
+	rh = n.find(segments)
+	if rh == nil {
+		return
+	}
+	vars = rh.Route.vars(segments)
+	return
+}
+
+func (n *node) find(segments []string) *RouteHandler {
+	if len(segments) == 0 {
+		if n.route != nil {
+			return n.route
+		}
+		// A catch-all matches an empty remainder, e.g. /files/{path...} matches /files.
+		if n.catchAll != nil {
+			return n.catchAll.route
+		}
+		return nil
+	}
+	s := segments[0]
+	if child, ok := n.static[strings.ToLower(s)]; ok {
+		if rh := child.find(segments[1:]); rh != nil {
+			return rh
+		}
+	}
+	for _, v := range n.variables {
+		if v.segment.constraint != nil && !v.segment.constraint(s) {
+			continue
+		}
+		if rh := v.find(segments[1:]); rh != nil {
+			return rh
+		}
+	}
+	if n.wildcard != nil {
+		if rh := n.wildcard.find(segments[1:]); rh != nil {
+			return rh
+		}
+		// A wildcard at the end of a route matches the rest of the path.
+		if n.wildcard.route != nil {
+			return n.wildcard.route
+		}
+	}
+	if n.catchAll != nil {
+		return n.catchAll.route
+	}
+	return nil
+}
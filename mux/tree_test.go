@@ -0,0 +1,315 @@
+package mux
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	var tests = []struct {
+		name            string
+		patterns        []string
+		path            string
+		expectedPattern string
+		expectedVars    map[string]string
+	}{
+		{
+			name:            "static segments are preferred over variables",
+			patterns:        []string{"/users/{id}", "/users/new"},
+			path:            "/users/new",
+			expectedPattern: "/users/new",
+			expectedVars:    map[string]string{},
+		},
+		{
+			name:            "variables are preferred over wildcards",
+			patterns:        []string{"/users/*", "/users/{id}"},
+			path:            "/users/123",
+			expectedPattern: "/users/{id}",
+			expectedVars:    map[string]string{"id": "123"},
+		},
+		{
+			name:            "static segments are matched case insensitively",
+			patterns:        []string{"/Users/New"},
+			path:            "/users/new",
+			expectedPattern: "/Users/New",
+			expectedVars:    map[string]string{},
+		},
+		{
+			name:            "less specific branches are tried if a branch doesn't lead to a route",
+			patterns:        []string{"/users/new", "/users/{id}/edit"},
+			path:            "/users/new/edit",
+			expectedPattern: "/users/{id}/edit",
+			expectedVars:    map[string]string{"id": "new"},
+		},
+		{
+			name:            "variable names can differ between routes",
+			patterns:        []string{"/users/{id}", "/users/{name}/posts"},
+			path:            "/users/alice/posts",
+			expectedPattern: "/users/{name}/posts",
+			expectedVars:    map[string]string{"name": "alice"},
+		},
+		{
+			name:            "wildcards match a single segment",
+			patterns:        []string{"/*/edit"},
+			path:            "/a/edit",
+			expectedPattern: "/*/edit",
+			expectedVars:    map[string]string{},
+		},
+		{
+			name:            "trailing wildcards match the rest of the path",
+			patterns:        []string{"/files/*"},
+			path:            "/files/a/b/c.gmi",
+			expectedPattern: "/files/*",
+			expectedVars:    map[string]string{},
+		},
+		{
+			name:            "constrained variables are preferred over other variables",
+			patterns:        []string{"/users/{name}", "/users/{id:int}"},
+			path:            "/users/123",
+			expectedPattern: "/users/{id:int}",
+			expectedVars:    map[string]string{"id": "123"},
+		},
+		{
+			name:            "values that don't match a constraint use the next route",
+			patterns:        []string{"/users/{name}", "/users/{id:int}"},
+			path:            "/users/alice",
+			expectedPattern: "/users/{name}",
+			expectedVars:    map[string]string{"name": "alice"},
+		},
+		{
+			name:            "regular expression constraints must match the whole segment",
+			patterns:        []string{"/posts/{slug:[a-z-]+}"},
+			path:            "/posts/hello-world",
+			expectedPattern: "/posts/{slug:[a-z-]+}",
+			expectedVars:    map[string]string{"slug": "hello-world"},
+		},
+		{
+			name:     "values that don't match any constraint aren't matched",
+			patterns: []string{"/posts/{slug:[a-z-]+}", "/posts/{id:int}"},
+			path:     "/posts/Hello_World",
+		},
+		{
+			name:            "catch-all variables capture the rest of the path",
+			patterns:        []string{"/files/{path...}"},
+			path:            "/files/a/b/c.gmi",
+			expectedPattern: "/files/{path...}",
+			expectedVars:    map[string]string{"path": "a/b/c.gmi"},
+		},
+		{
+			name:            "catch-all variables match an empty path",
+			patterns:        []string{"/files/{path...}"},
+			path:            "/files/",
+			expectedPattern: "/files/{path...}",
+			expectedVars:    map[string]string{"path": ""},
+		},
+		{
+			name:            "catch-all variables have the lowest precedence",
+			patterns:        []string{"/files/{path...}", "/files/*/edit"},
+			path:            "/files/a/edit",
+			expectedPattern: "/files/*/edit",
+			expectedVars:    map[string]string{},
+		},
+		{
+			name:     "routes must match the whole path",
+			patterns: []string{"/route/a"},
+			path:     "/x/route/a",
+		},
+		{
+			name:     "routes aren't matched by a prefix of the path",
+			patterns: []string{"/route"},
+			path:     "/route/a",
+		},
+		{
+			name:            "the root route matches the root path",
+			patterns:        []string{"/", "/a"},
+			path:            "/",
+			expectedPattern: "/",
+			expectedVars:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNode()
+			for _, p := range tt.patterns {
+				if err := n.insert(&RouteHandler{Route: NewRoute(p)}); err != nil {
+					t.Fatalf("failed to insert %q: %v", p, err)
+				}
+			}
+			rh, vars := n.match(pathSegments(tt.path))
+			if rh == nil {
+				if tt.expectedPattern != "" {
+					t.Fatalf("expected %q to match, but nothing matched", tt.expectedPattern)
+				}
+				return
+			}
+			if rh.Route.Pattern != tt.expectedPattern {
+				t.Errorf("expected pattern %q, got %q", tt.expectedPattern, rh.Route.Pattern)
+			}
+			if fmt.Sprint(vars) != fmt.Sprint(tt.expectedVars) {
+				t.Errorf("expected vars %v, got %v", tt.expectedVars, vars)
+			}
+		})
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	var tests = []struct {
+		pattern      string
+		path         string
+		expectedOK   bool
+		expectedVars map[string]string
+	}{
+		{pattern: "/users/{id}", path: "/users/123", expectedOK: true, expectedVars: map[string]string{"id": "123"}},
+		{pattern: "/users/{id:int}", path: "/users/abc", expectedOK: false},
+		{pattern: "/users/{id:int}", path: "/users/123", expectedOK: true, expectedVars: map[string]string{"id": "123"}},
+		{pattern: "/files/{path...}", path: "/files/a/b.gmi", expectedOK: true, expectedVars: map[string]string{"path": "a/b.gmi"}},
+		{pattern: "/files/{path...}", path: "/files", expectedOK: true, expectedVars: map[string]string{"path": ""}},
+		{pattern: "/users/{id}", path: "/users/123/posts", expectedOK: false},
+		{pattern: "/a/*", path: "/a/b/c", expectedOK: true, expectedVars: map[string]string{}},
+		{pattern: "/a/*", path: "/a", expectedOK: false},
+		{pattern: "/a/*/c", path: "/a/b/c", expectedOK: true, expectedVars: map[string]string{}},
+		{pattern: "/a/*/c", path: "/a/b/d", expectedOK: false},
+		{pattern: "/Users/New", path: "/users/new", expectedOK: true, expectedVars: map[string]string{}},
+		{pattern: "/app/{...}", path: "/app/a/b", expectedOK: true, expectedVars: map[string]string{}},
+		{pattern: "/", path: "/", expectedOK: true, expectedVars: map[string]string{}},
+		{pattern: "/", path: "/a", expectedOK: false},
+	}
+	for _, tt := range tests {
+		vars, ok := NewRoute(tt.pattern).Match(pathSegments(tt.path))
+		if ok != tt.expectedOK {
+			t.Errorf("%s %s: expected match %v, got %v", tt.pattern, tt.path, tt.expectedOK, ok)
+			continue
+		}
+		if ok && fmt.Sprint(vars) != fmt.Sprint(tt.expectedVars) {
+			t.Errorf("%s %s: expected vars %v, got %v", tt.pattern, tt.path, tt.expectedVars, vars)
+		}
+	}
+}
+
+func TestAddRouteConflicts(t *testing.T) {
+	var tests = []struct {
+		a, b           string
+		expectConflict bool
+	}{
+		{a: "/users/{id}", b: "/users/{name}", expectConflict: true},
+		{a: "/users/new", b: "/Users/New/", expectConflict: true},
+		{a: "/files/*", b: "/files/*", expectConflict: true},
+		{a: "/users/{id:int}", b: "/users/{n:int}", expectConflict: true},
+		{a: "/files/{path...}", b: "/files/{p...}", expectConflict: true},
+		{a: "/users/{id}", b: "/users/new", expectConflict: false},
+		{a: "/users/{id}", b: "/users/{id:int}", expectConflict: false},
+		{a: "/users/{id}", b: "/users/*", expectConflict: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if conflict := r != nil; conflict != tt.expectConflict {
+					t.Errorf("expected conflict %v, got %v", tt.expectConflict, r)
+				}
+			}()
+			m := NewMux()
+			m.AddRoute(tt.a, nil)
+			m.AddRoute(tt.b, nil)
+		})
+	}
+}
+
+func pathSegments(s string) []string {
+	return strings.Split(strings.TrimPrefix(strings.TrimSuffix(s, "/"), "/"), "/")
+}
+
+func benchmarkRoutes(n int) (routes []*RouteHandler, paths [][]string) {
+	for i := 0; i < n; i++ {
+		routes = append(routes, &RouteHandler{Route: NewRoute(fmt.Sprintf("/section%d/{id}/page%d", i%100, i))})
+	}
+	for i := 0; i < n; i += n / 10 {
+		paths = append(paths, pathSegments(fmt.Sprintf("/section%d/123/page%d", i%100, i)))
+	}
+	return
+}
+
+// linearMatch is the right-to-left matcher that routes were matched with before the
+// tree was introduced, kept as the baseline for BenchmarkLinearMatch.
+func linearMatch(r *Route, segments []string) (vars map[string]string, ok bool) {
+	vars = make(map[string]string)
+	var wildcard bool
+	for i := 0; i < len(r.Segments); i++ {
+		routeSegment := r.Segments[len(r.Segments)-1-i]
+		inputSegmentIndex := len(segments) - 1 - i
+		var inputSegment string
+		if inputSegmentIndex > -1 {
+			inputSegment = segments[inputSegmentIndex]
+		}
+		name, capture, wildcardMatch, matches := routeSegment.Match(inputSegment)
+		if matches {
+			wildcard = wildcardMatch
+		}
+		if wildcard {
+			matches = true
+		}
+		if !matches {
+			return
+		}
+		if capture {
+			vars[name] = inputSegment
+		}
+	}
+	ok = true
+	return
+}
+
+func BenchmarkLinearMatch(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		routes, paths := benchmarkRoutes(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				segments := paths[i%len(paths)]
+				for _, rh := range routes {
+					if _, ok := linearMatch(rh.Route, segments); ok {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTreeMatch(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		routes, paths := benchmarkRoutes(n)
+		tree := newNode()
+		for _, rh := range routes {
+			if err := tree.insert(rh); err != nil {
+				b.Fatalf("failed to insert route: %v", err)
+			}
+		}
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tree.match(paths[i%len(paths)])
+			}
+		})
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	var tests = []struct {
+		pattern     string
+		expectError bool
+	}{
+		{pattern: "/users/{id:int}"},
+		{pattern: "/files/{path...}"},
+		{pattern: "/posts/{id:[0-9]{3}}"},
+		{pattern: "/posts/{id:[0-9}", expectError: true},
+		{pattern: "/files/{path...}/edit", expectError: true},
+	}
+	for _, tt := range tests {
+		_, err := ParseRoute(tt.pattern)
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.pattern, tt.expectError, err)
+		}
+	}
+}
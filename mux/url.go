@@ -0,0 +1,148 @@
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/a-h/gemini"
+)
+
+// ErrUnknownRoute is returned when building a URL for a route name that hasn't been added.
+var ErrUnknownRoute = errors.New("mux: unknown route")
+
+// URL builds the URL of the named route, filling variables in the pattern with the
+// vars, which are given as name and value pairs, e.g.:
+//
+//	m.AddRoute("/users/{id}", userHandler, mux.Name("user"))
+//	u, err := m.URL("user", "id", "alice") // "/users/alice"
+//
+// Values are path escaped. The URL is relative to the host, e.g. /users/alice, unless
+// the route belongs to a Mux created by Host, in which case an absolute gemini:// URL
+// is returned. Routes of a Mux mounted with Mount include the mount prefix. Routes
+// within Host muxes can be built from the parent Mux.
+func (m *Mux) URL(name string, vars ...string) (u string, err error) {
+	values, err := varMap(vars)
+	if err != nil {
+		return
+	}
+	owner, rh, ok := m.route(name)
+	if !ok {
+		err = fmt.Errorf("%w %q", ErrUnknownRoute, name)
+		return
+	}
+	path, err := fill(rh.Route, values)
+	if err != nil {
+		return
+	}
+	host := owner.host
+	for current := owner; ; {
+		current.m.RLock()
+		parent, prefix := current.mountedIn, current.mountPattern
+		current.m.RUnlock()
+		if parent == nil {
+			break
+		}
+		p, err := fill(prefix, values)
+		if err != nil {
+			return "", err
+		}
+		path = strings.TrimSuffix(p, "/") + path
+		if host == "" {
+			host = parent.host
+		}
+		current = parent
+	}
+	if host != "" {
+		return (&url.URL{Scheme: "gemini", Host: host}).String() + path, nil
+	}
+	return path, nil
+}
+
+// AbsoluteURL builds the URL of the named route, see URL, as an absolute gemini:// URL. If
+// the route doesn't belong to a Mux created by Host, the host of the request is used.
+func (m *Mux) AbsoluteURL(r *gemini.Request, name string, vars ...string) (u string, err error) {
+	u, err = m.URL(name, vars...)
+	if err != nil || !strings.HasPrefix(u, "/") {
+		return
+	}
+	return (&url.URL{Scheme: "gemini", Host: r.URL.Host}).String() + u, nil
+}
+
+// route finds the named route in the Mux, or in its Host muxes.
+func (m *Mux) route(name string) (owner *Mux, rh *RouteHandler, ok bool) {
+	m.m.RLock()
+	rh, ok = m.names[name]
+	hosts := make([]string, 0, len(m.hosts))
+	for h := range m.hosts {
+		hosts = append(hosts, h)
+	}
+	m.m.RUnlock()
+	if ok {
+		return m, rh, true
+	}
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		if owner, rh, ok = m.Host(h).route(name); ok {
+			return
+		}
+	}
+	return
+}
+
+func varMap(vars []string) (values map[string]string, err error) {
+	if len(vars)%2 != 0 {
+		err = fmt.Errorf("mux: expected name and value pairs, got %d values", len(vars))
+		return
+	}
+	values = make(map[string]string, len(vars)/2)
+	for i := 0; i < len(vars); i += 2 {
+		values[vars[i]] = vars[i+1]
+	}
+	return
+}
+
+// fill the variables of the route with the values, returning an escaped path.
+func fill(r *Route, values map[string]string) (path string, err error) {
+	var sb strings.Builder
+	for _, seg := range r.Segments {
+		switch {
+		case seg.IsWildcard:
+			return "", fmt.Errorf("mux: can't build a URL for %q, it contains a wildcard", r.Pattern)
+		case seg.IsCatchAll:
+			v, ok := values[seg.Name]
+			if !ok && seg.Name != "" {
+				return "", fmt.Errorf("%w %q", ErrMissingVar, seg.Name)
+			}
+			if v == "" {
+				continue
+			}
+			for _, part := range strings.Split(strings.TrimPrefix(v, "/"), "/") {
+				sb.WriteString("/")
+				sb.WriteString(url.PathEscape(part))
+			}
+		case seg.IsVariable:
+			v, ok := values[seg.Name]
+			if !ok {
+				return "", fmt.Errorf("%w %q", ErrMissingVar, seg.Name)
+			}
+			if seg.constraint != nil && !seg.constraint(v) {
+				return "", fmt.Errorf("%w %q: %q doesn't match %q", ErrInvalidVar, seg.Name, v, seg.Constraint)
+			}
+			sb.WriteString("/")
+			sb.WriteString(url.PathEscape(v))
+		case seg.Name == "":
+			// The root of the path.
+		default:
+			sb.WriteString("/")
+			sb.WriteString(url.PathEscape(seg.Name))
+		}
+	}
+	path = sb.String()
+	if path == "" || (strings.HasSuffix(r.Pattern, "/") && !strings.HasSuffix(path, "/")) {
+		path += "/"
+	}
+	return
+}
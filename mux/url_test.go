@@ -0,0 +1,91 @@
+package mux
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/a-h/gemini"
+)
+
+func TestURL(t *testing.T) {
+	users := NewMux()
+	users.AddRoute("/", nil, Name("posts"))
+	users.AddRoute("/{post}", nil, Name("post"))
+
+	m := NewMux()
+	m.AddRoute("/", nil, Name("home"))
+	m.AddRoute("/users/{id:int}", nil, Name("user"))
+	m.AddRoute("/search/{query}/", nil, Name("search"))
+	m.AddRoute("/files/{path...}", nil, Name("file"))
+	m.AddRoute("/any/*", nil, Name("wildcard"))
+	m.Mount("/users/{id}/posts", users)
+	m.Group("/admin").AddRoute("/settings", nil, Name("settings"))
+	reports := NewMux()
+	reports.AddRoute("/{report}", nil, Name("report"))
+	passThrough := func(next gemini.Handler) gemini.Handler {
+		return gemini.HandlerFunc(next.ServeGemini)
+	}
+	m.Group("/admin", passThrough).Mount("/reports", reports)
+	m.Host("docs.example.org").AddRoute("/{page}", nil, Name("docs"))
+
+	var tests = []struct {
+		mux           *Mux
+		name          string
+		vars          []string
+		expected      string
+		expectedError error
+	}{
+		{mux: m, name: "home", expected: "/"},
+		{mux: m, name: "user", vars: []string{"id", "123"}, expected: "/users/123"},
+		{mux: m, name: "search", vars: []string{"query", "a b/c?"}, expected: "/search/a%20b%2Fc%3F/"},
+		{mux: m, name: "file", vars: []string{"path", "a b/c.gmi"}, expected: "/files/a%20b/c.gmi"},
+		{mux: m, name: "file", vars: []string{"path", ""}, expected: "/files"},
+		{mux: m, name: "settings", expected: "/admin/settings"},
+		{mux: m, name: "docs", vars: []string{"page", "intro"}, expected: "gemini://docs.example.org/intro"},
+		{mux: users, name: "posts", vars: []string{"id", "1"}, expected: "/users/1/posts/"},
+		{mux: users, name: "post", vars: []string{"id", "1", "post", "hello"}, expected: "/users/1/posts/hello"},
+		{mux: reports, name: "report", vars: []string{"report", "daily"}, expected: "/admin/reports/daily"},
+		{mux: m, name: "missing", expectedError: ErrUnknownRoute},
+		{mux: m, name: "user", expectedError: ErrMissingVar},
+		{mux: m, name: "user", vars: []string{"id", "abc"}, expectedError: ErrInvalidVar},
+		{mux: users, name: "post", vars: []string{"post", "hello"}, expectedError: ErrMissingVar},
+	}
+	for _, tt := range tests {
+		actual, err := tt.mux.URL(tt.name, tt.vars...)
+		if !errors.Is(err, tt.expectedError) {
+			t.Errorf("%s %v: expected error %v, got %v", tt.name, tt.vars, tt.expectedError, err)
+			continue
+		}
+		if actual != tt.expected {
+			t.Errorf("%s %v: expected %q, got %q", tt.name, tt.vars, tt.expected, actual)
+		}
+	}
+
+	if _, err := m.URL("wildcard"); err == nil {
+		t.Errorf("expected an error building a URL for a wildcard route")
+	}
+	if _, err := m.URL("user", "id"); err == nil {
+		t.Errorf("expected an error for unpaired vars")
+	}
+
+	r := &gemini.Request{URL: &url.URL{Scheme: "gemini", Host: "example.org:1965", Path: "/"}}
+	abs, err := m.AbsoluteURL(r, "user", "id", "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if abs != "gemini://example.org:1965/users/1" {
+		t.Errorf("unexpected absolute URL %q", abs)
+	}
+}
+
+func TestAddRouteDuplicateName(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic when a route name is reused")
+		}
+	}()
+	m := NewMux()
+	m.AddRoute("/a", nil, Name("a"))
+	m.AddRoute("/b", nil, Name("a"))
+}
@@ -0,0 +1,109 @@
+package gemini
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy configures how a Client retries requests that result in a temporary
+// failure (4x) status. Permanent failures (5x) and client certificate errors (6x) are
+// never retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a request is retried after the initial attempt.
+	MaxRetries int
+	// MinBackoff is the delay before the first retry. Each subsequent retry doubles the delay.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay between retries. A 44 (slow down) response
+	// can request a longer delay, up to MaxSlowDown.
+	MaxBackoff time.Duration
+	// MaxSlowDown is the longest delay requested by a 44 (slow down) response that's
+	// honoured, longer delays are reduced to it. Defaults to DefaultMaxSlowDown.
+	MaxSlowDown time.Duration
+	// random returns a number in the range [0.0,1.0), it's used to add jitter.
+	random func() float64
+}
+
+// DefaultMaxSlowDown is the longest delay requested by a 44 (slow down) response that's
+// honoured, unless RetryPolicy.MaxSlowDown is set.
+const DefaultMaxSlowDown = time.Minute * 5
+
+// NewRetryPolicy creates a policy that retries temporary failures up to maxRetries times,
+// starting with a 1 second delay and backing off exponentially up to 30 seconds.
+func NewRetryPolicy(maxRetries int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:  maxRetries,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Second * 30,
+		MaxSlowDown: DefaultMaxSlowDown,
+	}
+}
+
+// Delay returns how long to wait before retrying a request that resulted in header h,
+// and whether the request should be retried at all. retry is the number of retries
+// already made.
+func (p *RetryPolicy) Delay(retry int, h *Header) (d time.Duration, ok bool) {
+	if p == nil || retry >= p.MaxRetries || h == nil || len(h.Code) == 0 || h.Code[0] != '4' {
+		return
+	}
+	if h.Code == CodeSlowDown {
+		if seconds, err := strconv.Atoi(strings.TrimSpace(h.Meta)); err == nil && seconds >= 0 {
+			return p.slowDown(seconds), true
+		}
+	}
+	d = p.MinBackoff
+	for i := 0; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	// Use "equal jitter" so that clients spread their retries, but still back off.
+	random := p.random
+	if random == nil {
+		random = rand.Float64
+	}
+	d = d/2 + time.Duration(random()*float64(d/2))
+	return d, true
+}
+
+// slowDown returns the delay requested by a 44 (slow down) response, limited to MaxSlowDown.
+func (p *RetryPolicy) slowDown(seconds int) time.Duration {
+	max := p.MaxSlowDown
+	if max <= 0 {
+		max = DefaultMaxSlowDown
+	}
+	// Compare in seconds, so that large values don't overflow.
+	if time.Duration(seconds) > max/time.Second {
+		return max
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// retry makes requests using do until the RetryPolicy says to stop. If the context
+// deadline would pass before the next attempt, the last response is returned.
+func (p *RetryPolicy) retry(ctx context.Context, do func() (*Response, error)) (resp *Response, err error) {
+	for retry := 0; ; retry++ {
+		resp, err = do()
+		if err != nil || resp == nil {
+			return
+		}
+		d, ok := p.Delay(retry, resp.Header)
+		if !ok {
+			return
+		}
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Now().Add(d).After(deadline) {
+			return
+		}
+		resp.Body.Close()
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
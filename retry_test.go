@@ -0,0 +1,221 @@
+package gemini
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := &RetryPolicy{
+		MaxRetries: 3,
+		MinBackoff: time.Second,
+		MaxBackoff: time.Second * 3,
+		random:     func() float64 { return 1 },
+	}
+	var tests = []struct {
+		name          string
+		policy        *RetryPolicy
+		retry         int
+		header        Header
+		expectedDelay time.Duration
+		expectedOK    bool
+	}{
+		{
+			name:       "a nil policy never retries",
+			policy:     nil,
+			header:     Header{Code: CodeTemporaryFailure},
+			expectedOK: false,
+		},
+		{
+			name:       "success is not retried",
+			policy:     p,
+			header:     Header{Code: CodeSuccess, Meta: DefaultMIMEType},
+			expectedOK: false,
+		},
+		{
+			name:       "permanent failures are not retried",
+			policy:     p,
+			header:     Header{Code: CodeNotFound, Meta: "not found"},
+			expectedOK: false,
+		},
+		{
+			name:       "client certificate errors are not retried",
+			policy:     p,
+			header:     Header{Code: CodeClientCertificateRequired},
+			expectedOK: false,
+		},
+		{
+			name:          "temporary failures are retried after the minimum backoff",
+			policy:        p,
+			header:        Header{Code: CodeServerUnavailable},
+			expectedDelay: time.Second,
+			expectedOK:    true,
+		},
+		{
+			name:          "the backoff doubles with each retry",
+			policy:        p,
+			retry:         1,
+			header:        Header{Code: CodeTemporaryFailure},
+			expectedDelay: time.Second * 2,
+			expectedOK:    true,
+		},
+		{
+			name:          "the backoff is limited to the maximum",
+			policy:        p,
+			retry:         2,
+			header:        Header{Code: CodeTemporaryFailure},
+			expectedDelay: time.Second * 3,
+			expectedOK:    true,
+		},
+		{
+			name:       "requests are not retried more than the maximum",
+			policy:     p,
+			retry:      3,
+			header:     Header{Code: CodeTemporaryFailure},
+			expectedOK: false,
+		},
+		{
+			name:          "slow down responses are retried after the requested number of seconds",
+			policy:        p,
+			header:        Header{Code: CodeSlowDown, Meta: "10"},
+			expectedDelay: time.Second * 10,
+			expectedOK:    true,
+		},
+		{
+			name:          "slow down delays are limited to the maximum",
+			policy:        &RetryPolicy{MaxRetries: 1, MaxSlowDown: time.Second * 30},
+			header:        Header{Code: CodeSlowDown, Meta: "3600"},
+			expectedDelay: time.Second * 30,
+			expectedOK:    true,
+		},
+		{
+			name:          "slow down delays are limited to the default maximum if one isn't set",
+			policy:        p,
+			header:        Header{Code: CodeSlowDown, Meta: "99999999999999"},
+			expectedDelay: DefaultMaxSlowDown,
+			expectedOK:    true,
+		},
+		{
+			name:          "slow down responses without a valid delay use the backoff",
+			policy:        p,
+			header:        Header{Code: CodeSlowDown, Meta: "slow down"},
+			expectedDelay: time.Second,
+			expectedOK:    true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := tt.policy.Delay(tt.retry, &tt.header)
+			if ok != tt.expectedOK {
+				t.Errorf("expected ok %v, got %v", tt.expectedOK, ok)
+			}
+			if d != tt.expectedDelay {
+				t.Errorf("expected delay %v, got %v", tt.expectedDelay, d)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	p := NewRetryPolicy(1)
+	for i := 0; i < 100; i++ {
+		d, _ := p.Delay(0, &Header{Code: CodeTemporaryFailure})
+		if d < p.MinBackoff/2 || d > p.MinBackoff {
+			t.Fatalf("expected delay between %v and %v, got %v", p.MinBackoff/2, p.MinBackoff, d)
+		}
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var tests = []struct {
+		name          string
+		maxRetries    int
+		timeout       time.Duration
+		responses     []string
+		expectedCode  Code
+		expectedCalls int
+	}{
+		{
+			name:          "temporary failures are retried until success",
+			maxRetries:    3,
+			responses:     []string{"41 unavailable\r\n", "44 0\r\n", "20 text/gemini\r\n"},
+			expectedCode:  CodeSuccess,
+			expectedCalls: 3,
+		},
+		{
+			name:          "the last failure is returned when retries are exhausted",
+			maxRetries:    1,
+			responses:     []string{"40 failed\r\n", "41 unavailable\r\n", "20 text/gemini\r\n"},
+			expectedCode:  CodeServerUnavailable,
+			expectedCalls: 2,
+		},
+		{
+			name:          "permanent failures are returned immediately",
+			maxRetries:    3,
+			responses:     []string{"51 not found\r\n", "20 text/gemini\r\n"},
+			expectedCode:  CodeNotFound,
+			expectedCalls: 1,
+		},
+		{
+			name:          "retries are not made if they would exceed the context deadline",
+			maxRetries:    3,
+			timeout:       time.Second,
+			responses:     []string{"44 60\r\n", "20 text/gemini\r\n"},
+			expectedCode:  CodeSlowDown,
+			expectedCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer l.Close()
+			var calls int32
+			go func() {
+				for _, r := range tt.responses {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					atomic.AddInt32(&calls, 1)
+					readUntilCrLf(conn, 1026)
+					conn.Write([]byte(r))
+					conn.Close()
+				}
+			}()
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			client := NewClient()
+			client.Retry = &RetryPolicy{
+				MaxRetries: tt.maxRetries,
+				MinBackoff: time.Millisecond,
+				MaxBackoff: time.Millisecond * 10,
+			}
+			u, _ := url.Parse("gemini://" + l.Addr().String() + "/")
+			resp, err := client.RequestNoTLS(ctx, u)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.Header.Code != tt.expectedCode {
+				t.Errorf("expected code %v, got %v", tt.expectedCode, resp.Header.Code)
+			}
+			if actual := int(atomic.LoadInt32(&calls)); actual != tt.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectedCalls, actual)
+			}
+		})
+	}
+}
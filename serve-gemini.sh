@@ -25,32 +25,22 @@ if [ "$DOMAIN" = "" ];
 then
 	export DOMAIN=localhost;
 fi
-if [ ! -d /certs ]; 
-then
-	echo "Docker usage:"
-	echo ""
-	echo "Create server certificates with the domain set as the common name (all other fields can be left default):"
-	echo "  openssl ecparam -genkey -name secp384r1 -out server.key"
-	echo "  openssl req -new -x509 -sha256 -key server.key -out server.crt -days 3650"
-	echo ""
-	echo "Then run Docker container:"
-	echo ""
-	echo "  docker run -v /path_to_your_cert_files:/certs -e PORT=1965 -e DOMAIN=localhost -v /path_to_your_content:/content -p 1965:1965 adrianhesketh/gemini:latest"
-	echo ""
-	return
-fi
-if [ ! -e /certs/server.crt ];
-then
-	echo "server.crt file not found, are your certs named correctly?"
-fi
-if [ ! -e /certs/server.key ];
-then
-	echo "server.key file not found, are your certs named correctly?"
-fi
 
 # run application
-# Run server.
-./gemini serve --path=/content --certFile=/certs/server.crt --keyFile=/certs/server.key --port=$PORT --domain=$DOMAIN &
+# Run server, using certificates from /certs if they're provided, or generating
+# a self-signed certificate in /certs (or /state if /certs isn't mounted).
+if [ -e /certs/server.crt ] && [ -e /certs/server.key ];
+then
+	./gemini serve --path=/content --certFile=/certs/server.crt --keyFile=/certs/server.key --port=$PORT --domain=$DOMAIN &
+else
+	STATE_DIR=/state
+	if [ -d /certs ];
+	then
+		STATE_DIR=/certs
+	fi
+	echo "server.crt / server.key not found in /certs, using a self-signed certificate stored in $STATE_DIR"
+	./gemini serve --path=/content --autoCert --stateDir=$STATE_DIR --port=$PORT --domain=$DOMAIN &
+fi
 pid="$!"
 
 # wait forever
@@ -2,9 +2,8 @@ package gemini
 
 import (
 	"context"
-	"crypto/sha256"
 	"crypto/tls"
-	"encoding/base64"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	certpkg "github.com/a-h/gemini/cert"
 	"github.com/a-h/gemini/log"
 )
 
@@ -44,14 +44,62 @@ type Request struct {
 
 // Certificate information provided to the server by the client.
 type Certificate struct {
-	// ID is the base64-encoded SHA256 hash of the key.
+	// ID is the base64-encoded SHA256 hash of the certificate.
 	ID string
-	// Key is the user public key in PKIX, ASN.1 DER form.
+	// PublicKeyID is the base64-encoded SHA256 hash of the certificate's public key
+	// (SubjectPublicKeyInfo). It doesn't change when a certificate is re-issued for the same key.
+	PublicKeyID string
+	// Key is the client certificate in ASN.1 DER form. Use PublicKeyID to identify the
+	// public key, or Leaf.PublicKey to read it.
 	Key string
+	// CommonName of the certificate subject.
+	CommonName string
+	// SANs are the subject alternative names of the certificate: DNS names, email
+	// addresses, IP addresses and URIs.
+	SANs      []string
+	NotBefore time.Time
+	NotAfter  time.Time
+	// Leaf is the parsed client certificate.
+	Leaf *x509.Certificate
+	// Chain is the full chain of certificates presented by the client, starting with the Leaf.
+	Chain []*x509.Certificate
 	// Error is an error message related to any failures in handling the client certificate.
 	Error string
 }
 
+// NewCertificate creates the Certificate information for a chain of certificates presented
+// by a client. The first certificate in the chain is the client's certificate. If the chain
+// is empty, an empty Certificate is returned.
+func NewCertificate(chain []*x509.Certificate, now time.Time) (c Certificate) {
+	if len(chain) == 0 {
+		return
+	}
+	leaf := chain[0]
+	c.ID = certpkg.Fingerprint(leaf)
+	c.PublicKeyID = certpkg.PublicKeyFingerprint(leaf)
+	c.Key = string(leaf.Raw)
+	c.CommonName = leaf.Subject.CommonName
+	c.SANs = append(c.SANs, leaf.DNSNames...)
+	c.SANs = append(c.SANs, leaf.EmailAddresses...)
+	for _, ip := range leaf.IPAddresses {
+		c.SANs = append(c.SANs, ip.String())
+	}
+	for _, uri := range leaf.URIs {
+		c.SANs = append(c.SANs, uri.String())
+	}
+	c.NotBefore = leaf.NotBefore
+	c.NotAfter = leaf.NotAfter
+	c.Leaf = leaf
+	c.Chain = chain
+	if now.Before(leaf.NotBefore) {
+		c.Error = "certificate not yet valid"
+	}
+	if now.After(leaf.NotAfter) {
+		c.Error = "certificate expired"
+	}
+	return
+}
+
 // ResponseWriter used by handlers to send a response to the client.
 type ResponseWriter interface {
 	io.Writer
@@ -99,12 +147,14 @@ func NewServer(ctx context.Context, addr string, domainToHandler map[string]*Dom
 		domainToHandler[strings.ToLower(k)] = v
 	}
 	return &Server{
-		Context:         ctx,
-		Addr:            addr,
-		DomainToHandler: domainToHandler,
-		ReadTimeout:     time.Second * 5,
-		WriteTimeout:    time.Second * 10,
-		HandlerTimeout:  time.Second * 30,
+		Context:             ctx,
+		Addr:                addr,
+		DomainToHandler:     domainToHandler,
+		ReadTimeout:         time.Second * 5,
+		WriteTimeout:        time.Second * 10,
+		HandlerTimeout:      time.Second * 30,
+		ExpiryWarnings:      DefaultExpiryWarnings,
+		ExpiryCheckInterval: time.Hour * 24,
 	}
 }
 
@@ -117,6 +167,10 @@ type Server struct {
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
 	HandlerTimeout  time.Duration
+	// ExpiryWarnings are the thresholds at which warnings are logged for certificates that are about to expire.
+	ExpiryWarnings []time.Duration
+	// ExpiryCheckInterval is how often certificate expiry is checked. If zero, it's only checked on start.
+	ExpiryCheckInterval time.Duration
 }
 
 // Set the server listening on the specified port.
@@ -141,6 +195,7 @@ func (srv *Server) ListenAndServe() error {
 			log.Error("gemini: serveInsecure failure", err, log.String("addr", addr))
 		}
 	} else {
+		go srv.monitorExpiry()
 		err = srv.serveTLS(ln)
 		if err != nil {
 			log.Error("gemini: serveTLS failure", err, log.String("addr", addr))
@@ -219,21 +274,7 @@ func (srv *Server) handleTLS(conn *tls.Conn) {
 		log.Info("gemini: failed TLS handshake", log.String("remote", conn.RemoteAddr().String()), log.String("reason", err.Error()))
 		return
 	}
-	var certificate Certificate
-	peerCerts := conn.ConnectionState().PeerCertificates
-	if len(peerCerts) > 0 {
-		now := time.Now()
-		cert := peerCerts[0]
-		certHash := sha256.Sum256(cert.Raw)
-		certificate.ID = base64.StdEncoding.EncodeToString(certHash[:])
-		certificate.Key = string(cert.Raw)
-		if now.Before(cert.NotBefore) {
-			certificate.Error = "certificate not yet valid"
-		}
-		if now.After(cert.NotAfter) {
-			certificate.Error = "certificate expired"
-		}
-	}
+	certificate := NewCertificate(conn.ConnectionState().PeerCertificates, time.Now())
 	serverName := conn.ConnectionState().ServerName
 	dh, ok := srv.DomainToHandler[strings.ToLower(serverName)]
 	if !ok {
@@ -419,6 +460,16 @@ func NewDomainHandlerFromFiles(serverName, certFile, keyFile string, handler Han
 	return NewDomainHandler(serverName, keyPair, handler), nil
 }
 
+// NewDomainHandlerFromStore creates a new handler to listen for Gemini requests using TLS.
+// The certificate is loaded from the store entry named after the serverName.
+func NewDomainHandlerFromStore(serverName string, store certpkg.Store, handler Handler) (*DomainHandler, error) {
+	keyPair, err := certpkg.LoadKeyPair(store, strings.ToLower(serverName))
+	if err != nil {
+		return nil, fmt.Errorf("gemini: failed to load certificate for %q: %w", serverName, err)
+	}
+	return NewDomainHandler(serverName, keyPair, handler), nil
+}
+
 // ListenAndServe starts up a new server to handle multiple domains with a specific certFile, keyFile and handler.
 func ListenAndServe(ctx context.Context, addr string, domains ...*DomainHandler) (err error) {
 	if len(domains) == 0 {
@@ -3,12 +3,16 @@ package gemini
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/x509"
 	"io/ioutil"
 	"net"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/a-h/gemini/cert"
 )
 
 func TestServer(t *testing.T) {
@@ -329,3 +333,79 @@ func TestWriter(t *testing.T) {
 	}
 
 }
+
+func TestNewCertificate(t *testing.T) {
+	ca, err := cert.NewCA(cert.Options{CommonName: "Team CA", Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	certPEM, _, err := ca.SignClient(cert.Options{CommonName: "alice", Hosts: []string{"alice.example.com", "127.0.0.1"}, Duration: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to sign client certificate: %v", err)
+	}
+	certs, err := cert.DecodeCertificates(certPEM)
+	if err != nil {
+		t.Fatalf("failed to decode certificate: %v", err)
+	}
+	leaf := certs[0]
+	chain := []*x509.Certificate{leaf, ca.Certificate}
+
+	t.Run("an empty chain results in an empty certificate", func(t *testing.T) {
+		c := NewCertificate(nil, time.Now())
+		if !reflect.DeepEqual(c, Certificate{}) {
+			t.Errorf("expected empty certificate, got %+v", c)
+		}
+	})
+	t.Run("certificate details are populated", func(t *testing.T) {
+		c := NewCertificate(chain, time.Now())
+		if c.ID != cert.Fingerprint(leaf) {
+			t.Errorf("expected ID %q, got %q", cert.Fingerprint(leaf), c.ID)
+		}
+		if c.PublicKeyID != cert.PublicKeyFingerprint(leaf) {
+			t.Errorf("expected public key ID %q, got %q", cert.PublicKeyFingerprint(leaf), c.PublicKeyID)
+		}
+		if c.Key != string(leaf.Raw) {
+			t.Errorf("expected the key to be unchanged, the DER encoded certificate")
+		}
+		if c.CommonName != "alice" {
+			t.Errorf("expected common name %q, got %q", "alice", c.CommonName)
+		}
+		if !reflect.DeepEqual(c.SANs, []string{"alice.example.com", "127.0.0.1"}) {
+			t.Errorf("unexpected SANs: %v", c.SANs)
+		}
+		if !c.NotAfter.Equal(leaf.NotAfter) || !c.NotBefore.Equal(leaf.NotBefore) {
+			t.Errorf("unexpected validity: %v - %v", c.NotBefore, c.NotAfter)
+		}
+		if c.Leaf != leaf || len(c.Chain) != 2 {
+			t.Errorf("expected the leaf and chain to be set")
+		}
+		if c.Error != "" {
+			t.Errorf("unexpected error: %v", c.Error)
+		}
+	})
+	t.Run("expired certificates are reported", func(t *testing.T) {
+		c := NewCertificate(chain, time.Now().Add(time.Hour*2))
+		if c.Error != "certificate expired" {
+			t.Errorf("expected expiry error, got %q", c.Error)
+		}
+	})
+	t.Run("the public key ID is stable when a certificate is re-issued", func(t *testing.T) {
+		template := *leaf
+		template.NotAfter = leaf.NotAfter.Add(time.Hour)
+		der, err := x509.CreateCertificate(rand.Reader, &template, ca.Certificate, leaf.PublicKey, ca.Key)
+		if err != nil {
+			t.Fatalf("failed to re-issue certificate: %v", err)
+		}
+		reissued, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("failed to parse re-issued certificate: %v", err)
+		}
+		a, b := NewCertificate([]*x509.Certificate{leaf}, time.Now()), NewCertificate([]*x509.Certificate{reissued}, time.Now())
+		if a.ID == b.ID {
+			t.Errorf("expected the certificate IDs to differ")
+		}
+		if a.PublicKeyID != b.PublicKeyID {
+			t.Errorf("expected the public key IDs to match")
+		}
+	})
+}
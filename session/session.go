@@ -0,0 +1,189 @@
+// Package session provides sessions keyed by the client certificate. Gemini has no
+// cookies, so the fingerprint of the client certificate identifies the session.
+package session
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/a-h/gemini"
+	"github.com/a-h/gemini/log"
+)
+
+// Session holds values associated with a client certificate.
+type Session struct {
+	// ID of the session, the client certificate fingerprint.
+	ID string
+	// Expires is the time that the session expires, unless it's used before then.
+	Expires time.Time
+
+	m       sync.RWMutex
+	values  map[string]string
+	dirty   bool
+	deleted bool
+}
+
+// New creates an empty session.
+func New(id string, expires time.Time) *Session {
+	return &Session{
+		ID:      id,
+		Expires: expires,
+		values:  make(map[string]string),
+	}
+}
+
+// Get a value from the session.
+func (s *Session) Get(key string) (value string, ok bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	value, ok = s.values[key]
+	return
+}
+
+// Set a value in the session.
+func (s *Session) Set(key, value string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.values[key] = value
+	s.dirty = true
+	s.deleted = false
+}
+
+// Delete a value from the session.
+func (s *Session) Delete(key string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.values, key)
+	s.dirty = true
+}
+
+// Keys returns the keys of the values in the session, in order.
+func (s *Session) Keys() (keys []string) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Values returns a copy of the values in the session.
+func (s *Session) Values() map[string]string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return copyValues(s.values)
+}
+
+// Clear removes all values from the session, and removes the session from the store
+// at the end of the request.
+func (s *Session) Clear() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.values = make(map[string]string)
+	s.dirty = true
+	s.deleted = true
+}
+
+func copyValues(values map[string]string) map[string]string {
+	c := make(map[string]string, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
+
+type contextKey struct{}
+
+// WithSession returns a copy of the context that contains the session.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the session attached to the context by Handler.
+func FromContext(ctx context.Context) (s *Session, ok bool) {
+	if ctx == nil {
+		return
+	}
+	s, ok = ctx.Value(contextKey{}).(*Session)
+	return
+}
+
+// Get the session for the request. If the client didn't present a certificate, there is
+// no session, and ok is false.
+func Get(r *gemini.Request) (s *Session, ok bool) {
+	return FromContext(r.Context)
+}
+
+// DefaultTTL is the time that a session is kept after it was last used.
+const DefaultTTL = time.Hour * 24 * 30
+
+// Handler attaches the session of the client certificate to the request context, and
+// saves it to the store after h has handled the request. Sessions expire if they're not
+// used within the ttl, which defaults to DefaultTTL if it's zero. Requests without a client
+// certificate don't have a session, use gemini.RequireCertificateHandler or the auth package
+// to require one.
+func Handler(store Store, ttl time.Duration, h gemini.Handler) gemini.Handler {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return handler{store: store, ttl: ttl, next: h, now: time.Now}
+}
+
+type handler struct {
+	store Store
+	ttl   time.Duration
+	next  gemini.Handler
+	now   func() time.Time
+}
+
+func (sh handler) ServeGemini(w gemini.ResponseWriter, r *gemini.Request) {
+	id := r.Certificate.ID
+	if id == "" || r.Certificate.Error != "" {
+		sh.next.ServeGemini(w, r)
+		return
+	}
+	now := sh.now()
+	s, err := sh.store.Get(id)
+	if errors.Is(err, ErrNotFound) || (err == nil && now.After(s.Expires)) {
+		s, err = New(id, now.Add(sh.ttl)), nil
+	}
+	if err != nil {
+		log.Error("session: failed to load session", err, log.String("url", r.URL.String()))
+		w.SetHeader(gemini.CodeTemporaryFailure, "temporary failure")
+		return
+	}
+	s.Expires = now.Add(sh.ttl)
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sr := *r
+	sr.Context = WithSession(ctx, s)
+	sh.next.ServeGemini(w, &sr)
+	sh.save(s, r)
+}
+
+func (sh handler) save(s *Session, r *gemini.Request) {
+	s.m.RLock()
+	deleted, dirty, empty := s.deleted, s.dirty, len(s.values) == 0
+	s.m.RUnlock()
+	var err error
+	switch {
+	case deleted:
+		if err = sh.store.Delete(s.ID); errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+	case empty && !dirty:
+		// Don't store sessions that have never been used.
+		return
+	default:
+		err = sh.store.Put(s)
+	}
+	if err != nil {
+		log.Error("session: failed to save session", err, log.String("url", r.URL.String()))
+	}
+}
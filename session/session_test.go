@@ -0,0 +1,170 @@
+package session
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/a-h/gemini"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gemini_sessions")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create file store: %v", err)
+	}
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fs,
+	}
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for name, store := range stores {
+		store := store
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Get("a/b+c="); err != ErrNotFound {
+				t.Fatalf("expected ErrNotFound for missing session, got %v", err)
+			}
+			s := New("a/b+c=", now.Add(time.Hour))
+			s.Set("user", "alice")
+			if err := store.Put(s); err != nil {
+				t.Fatalf("failed to put session: %v", err)
+			}
+			expired := New("expired", now.Add(-time.Hour))
+			expired.Set("user", "bob")
+			if err := store.Put(expired); err != nil {
+				t.Fatalf("failed to put session: %v", err)
+			}
+			got, err := store.Get("a/b+c=")
+			if err != nil {
+				t.Fatalf("failed to get session: %v", err)
+			}
+			if v, _ := got.Get("user"); v != "alice" {
+				t.Errorf("expected user alice, got %q", v)
+			}
+			if !got.Expires.Equal(s.Expires) {
+				t.Errorf("expected expiry %v, got %v", s.Expires, got.Expires)
+			}
+			if err = store.DeleteExpired(now); err != nil {
+				t.Fatalf("failed to delete expired sessions: %v", err)
+			}
+			if _, err = store.Get("expired"); err != ErrNotFound {
+				t.Errorf("expected expired session to be deleted, got %v", err)
+			}
+			if err = store.Delete("a/b+c="); err != nil {
+				t.Fatalf("failed to delete session: %v", err)
+			}
+			if err = store.Delete("a/b+c="); err != ErrNotFound {
+				t.Errorf("expected ErrNotFound deleting a missing session, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	counter := gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		s, ok := Get(r)
+		if !ok {
+			w.Write([]byte("anonymous"))
+			return
+		}
+		if r.URL.Path == "/logout" {
+			s.Clear()
+			w.Write([]byte("logged out"))
+			return
+		}
+		v, _ := s.Get("visits")
+		v += "x"
+		s.Set("visits", v)
+		w.Write([]byte(v))
+	})
+	h := handler{store: store, ttl: time.Hour, next: counter, now: func() time.Time { return now }}
+
+	request := func(id, path string) string {
+		r := &gemini.Request{
+			Context:     context.Background(),
+			URL:         &url.URL{Scheme: "gemini", Host: "example.com", Path: path},
+			Certificate: gemini.Certificate{ID: id},
+		}
+		resp, err := gemini.Record(r, h)
+		if err != nil {
+			t.Fatalf("failed to record request: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		return string(body)
+	}
+
+	var tests = []struct {
+		name     string
+		advance  time.Duration
+		id       string
+		path     string
+		expected string
+	}{
+		{name: "requests without a certificate have no session", path: "/", expected: "anonymous"},
+		{name: "a session is created for new certificates", id: "a", path: "/", expected: "x"},
+		{name: "the session is retained between requests", id: "a", path: "/", expected: "xx"},
+		{name: "sessions are keyed by certificate", id: "b", path: "/", expected: "x"},
+		{name: "using a session extends its expiry", id: "a", advance: time.Minute * 59, path: "/", expected: "xxx"},
+		{name: "sessions expire after the ttl", id: "b", advance: time.Minute * 2, path: "/", expected: "x"},
+		{name: "sessions can be cleared", id: "a", path: "/logout", expected: "logged out"},
+		{name: "cleared sessions start again", id: "a", path: "/", expected: "x"},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		if actual := request(tt.id, tt.path); actual != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, actual)
+		}
+	}
+}
+
+func TestHandlerDefaultTTL(t *testing.T) {
+	var tests = []struct {
+		name     string
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		{name: "a zero ttl uses the default", ttl: 0, expected: DefaultTTL},
+		{name: "a negative ttl uses the default", ttl: -time.Hour, expected: DefaultTTL},
+		{name: "a positive ttl is used", ttl: time.Hour, expected: time.Hour},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			h := Handler(store, tt.ttl, gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+				s, _ := Get(r)
+				s.Set("visited", "true")
+				w.Write([]byte("ok"))
+			}))
+			start := time.Now()
+			r := &gemini.Request{
+				Context:     context.Background(),
+				URL:         &url.URL{Scheme: "gemini", Host: "example.com", Path: "/"},
+				Certificate: gemini.Certificate{ID: "a"},
+			}
+			if _, err := gemini.Record(r, h); err != nil {
+				t.Fatalf("failed to record request: %v", err)
+			}
+			s, err := store.Get("a")
+			if err != nil {
+				t.Fatalf("expected the session to be saved, got %v", err)
+			}
+			if s.Expires.Before(start.Add(tt.expected)) || s.Expires.After(time.Now().Add(tt.expected)) {
+				t.Errorf("expected the session to expire in %v, but it expires at %v", tt.expected, s.Expires)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-h/gemini/internal/atomicfile"
+	"github.com/a-h/gemini/log"
+)
+
+// Store of sessions, keyed by the session ID.
+type Store interface {
+	// Get a session. If the session doesn't exist, ErrNotFound is returned.
+	Get(id string) (*Session, error)
+	// Put a session, replacing any existing session with the same ID.
+	Put(s *Session) error
+	// Delete a session. If the session doesn't exist, ErrNotFound is returned.
+	Delete(id string) error
+	// DeleteExpired removes sessions that expired before now.
+	DeleteExpired(now time.Time) error
+}
+
+// ErrNotFound is returned when a Store doesn't contain the requested session.
+var ErrNotFound = errors.New("session: not found")
+
+// record is the stored form of a session.
+type record struct {
+	ID      string            `json:"id"`
+	Expires time.Time         `json:"expires"`
+	Values  map[string]string `json:"values"`
+}
+
+func newRecord(s *Session) record {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return record{
+		ID:      s.ID,
+		Expires: s.Expires,
+		Values:  copyValues(s.values),
+	}
+}
+
+func (r record) session() *Session {
+	s := New(r.ID, r.Expires)
+	for k, v := range r.Values {
+		s.values[k] = v
+	}
+	return s
+}
+
+// NewMemoryStore creates a Store that holds sessions in memory.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]record),
+	}
+}
+
+// MemoryStore holds sessions in memory. Sessions are lost when the process exits.
+type MemoryStore struct {
+	m        sync.RWMutex
+	sessions map[string]record
+}
+
+// Get a session.
+func (s *MemoryStore) Get(id string) (*Session, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	r, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.session(), nil
+}
+
+// Put a session.
+func (s *MemoryStore) Put(session *Session) error {
+	r := newRecord(session)
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.sessions[r.ID] = r
+	return nil
+}
+
+// Delete a session.
+func (s *MemoryStore) Delete(id string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+// DeleteExpired removes sessions that expired before now.
+func (s *MemoryStore) DeleteExpired(now time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for id, r := range s.sessions {
+		if now.After(r.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// NewFileStore creates a Store that keeps sessions as JSON files in dir, creating
+// the directory if required.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("session: failed to create store directory: %w", err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// FileStore keeps sessions in a directory, so that they survive restarts.
+type FileStore struct {
+	Dir string
+}
+
+const sessionExt = ".json"
+
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("session: invalid ID %q", id)
+	}
+	return filepath.Join(s.Dir, url.PathEscape(id)+sessionExt), nil
+}
+
+// Get a session.
+func (s *FileStore) Get(id string) (session *Session, err error) {
+	path, err := s.path(id)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = ErrNotFound
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("session: failed to read session: %w", err)
+		return
+	}
+	var r record
+	if err = json.Unmarshal(data, &r); err != nil {
+		err = fmt.Errorf("session: failed to decode session %q: %w", path, err)
+		return
+	}
+	session = r.session()
+	return
+}
+
+// Put a session. The session is written to a temporary file and renamed, so that
+// readers never see a partially written session.
+func (s *FileStore) Put(session *Session) (err error) {
+	path, err := s.path(session.ID)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(newRecord(session))
+	if err != nil {
+		return fmt.Errorf("session: failed to encode session: %w", err)
+	}
+	if err = atomicfile.Write(path, data, 0600); err != nil {
+		return fmt.Errorf("session: failed to write session: %w", err)
+	}
+	return nil
+}
+
+// Delete a session.
+func (s *FileStore) Delete(id string) (err error) {
+	path, err := s.path(id)
+	if err != nil {
+		return
+	}
+	if err = os.Remove(path); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return
+}
+
+// DeleteExpired removes sessions that expired before now.
+func (s *FileStore) DeleteExpired(now time.Time) error {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return fmt.Errorf("session: failed to list sessions: %w", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || !strings.HasSuffix(f.Name(), sessionExt) {
+			continue
+		}
+		id, err := url.PathUnescape(strings.TrimSuffix(f.Name(), sessionExt))
+		if err != nil {
+			continue
+		}
+		session, err := s.Get(id)
+		if err != nil {
+			return err
+		}
+		if now.After(session.Expires) {
+			if err = s.Delete(id); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteExpiredEvery removes expired sessions from the store at each interval, until
+// the done channel is closed.
+func DeleteExpiredEvery(store Store, interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			if err := store.DeleteExpired(now); err != nil {
+				log.Error("session: failed to delete expired sessions", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package gemini
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy sets how FileSystemHandler serves symbolic links.
+type SymlinkPolicy string
+
+const (
+	// SymlinksFollow serves the targets of symbolic links, wherever they are. This is the default.
+	SymlinksFollow SymlinkPolicy = "follow"
+	// SymlinksRefuse returns 51 (not found) for paths that include a symbolic link.
+	SymlinksRefuse SymlinkPolicy = "refuse"
+	// SymlinksWithinRoot serves the targets of symbolic links that are within the root of
+	// the file system, and returns 51 (not found) for those that aren't.
+	SymlinksWithinRoot SymlinkPolicy = "withinRoot"
+)
+
+// Validate checks that the policy is known.
+func (p SymlinkPolicy) Validate() error {
+	switch p {
+	case "", SymlinksFollow, SymlinksRefuse, SymlinksWithinRoot:
+		return nil
+	}
+	return fmt.Errorf("gemini: invalid symlink policy %q, expected %q, %q or %q", p, SymlinksFollow, SymlinksRefuse, SymlinksWithinRoot)
+}
+
+// A SymlinkFileSystem is a FileSystem that can contain symbolic links. Dir implements
+// SymlinkFileSystem. The symlink policy of FileSystemHandler only applies to file systems
+// that implement it.
+type SymlinkFileSystem interface {
+	FileSystem
+	// EvalSymlinks returns the name with any symbolic links resolved, relative to the root of
+	// the file system. inRoot is false if the resolved name is outside of the root.
+	EvalSymlinks(name string) (resolved string, inRoot bool, err error)
+}
+
+// EvalSymlinks implements SymlinkFileSystem.
+func (d Dir) EvalSymlinks(name string) (resolved string, inRoot bool, err error) {
+	dir := string(d)
+	if dir == "" {
+		dir = "."
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return
+	}
+	if target, err = filepath.Abs(target); err != nil {
+		return
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return target, false, nil
+	}
+	return path.Join("/", filepath.ToSlash(rel)), true, nil
+}
+
+// allows returns whether the policy allows the named file to be opened from fsys.
+func (p SymlinkPolicy) allows(fsys FileSystem, name string) (ok bool, err error) {
+	sfs, isSymlinkFS := fsys.(SymlinkFileSystem)
+	if p == "" || p == SymlinksFollow || !isSymlinkFS {
+		return true, nil
+	}
+	resolved, inRoot, err := sfs.EvalSymlinks(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Let the caller handle the missing file.
+			return true, nil
+		}
+		return false, err
+	}
+	if p == SymlinksWithinRoot {
+		return inRoot, nil
+	}
+	return inRoot && resolved == path.Clean("/"+name), nil
+}